@@ -7,18 +7,15 @@ package lzqapplication
  */
 
 import (
-	"encoding/json"
-	"errors"
 	"fmt"
 	"net/http"
 	"reflect"
 	"strings"
 
+	"github.com/zhaohuawu/lzq-framework/lzqerror"
 	"github.com/zhaohuawu/lzq-framework/lzqpkg"
 
 	"github.com/gin-gonic/gin"
-	"github.com/goinggo/mapstructure"
-	"xorm.io/builder"
 	"xorm.io/xorm"
 )
 
@@ -27,9 +24,13 @@ type BaseAppService struct {
 }
 
 type ResponseDto struct {
-	Code int         `json:"code"`                    //0：请求成功， >1：请求业务错误
-	Msg  string      `json:"msg"`                     //错误提示信息
-	Data interface{} `json:"data" swaggered:"object"` //接口返回的业务数据
+	Code      int           `json:"code"`                    //0：请求成功， >1：请求业务错误
+	Msg       string        `json:"msg"`                     //错误提示信息
+	Data      interface{}   `json:"data" swaggered:"object"` //接口返回的业务数据
+	ErrorCode string        `json:"errorCode,omitempty"`     //稳定的错误码，见 lzqerror.Error.Code
+	MsgKey    string        `json:"msgKey,omitempty"`        //错误提示信息的多语言key
+	Details   interface{}   `json:"details,omitempty"`       //错误详情
+	Meta      *ResponseMeta `json:"meta,omitempty"`          //响应包装方式为 meta 时返回
 }
 
 func (Base *BaseAppService) Response(c *gin.Context, code int, msg string, err error) {
@@ -40,14 +41,16 @@ func (Base *BaseAppService) Response(c *gin.Context, code int, msg string, err e
 	} else {
 		res.Msg = msg
 	}
-	c.JSON(http.StatusOK, res)
+	writeResponse(c, http.StatusOK, res)
 }
+
+// ResponseSuccess 返回成功，包装方式见 EnvelopePolicy，响应格式见 NegotiateFormat
 func (Base *BaseAppService) ResponseSuccess(c *gin.Context, obj interface{}) {
-	//var res ResponseDto
-	//res.Code = 1
-	//res.Msg = "success"
-	//res.Data = obj
-	c.JSON(http.StatusOK, obj)
+	if ResponseEnvelope() == EnvelopeRaw {
+		renderResponse(c, http.StatusOK, obj)
+		return
+	}
+	writeResponse(c, http.StatusOK, ResponseDto{Code: 0, Msg: "success", Data: obj})
 }
 func (Base *BaseAppService) ResponseError(c *gin.Context, err error) {
 	ResponseError(c, err)
@@ -57,13 +60,17 @@ func (Base *BaseAppService) ResponseBusinessError(c *gin.Context, err error) {
 	var res ResponseDto
 	res.Code = 1
 	res.Msg = err.Error()
-	c.JSON(http.StatusOK, res)
+	writeResponse(c, http.StatusOK, res)
 	return
 }
 
+// Respond 按错误类型返回对应的http状态码及 ResponseDto，err 为 nil 时返回成功
+func (Base *BaseAppService) Respond(c *gin.Context, err error) {
+	Respond(c, err)
+}
+
 func (Base *BaseAppService) ResponseSingleDto(c *gin.Context, obj1 interface{}, obj2 interface{}) {
-	resultMap := lzqpkg.StructToMap(obj1, true)
-	if err := mapstructure.Decode(resultMap, obj2); err != nil {
+	if err := mapToDto(obj1, obj2); err != nil {
 		Base.ResponseError(c, err)
 		return
 	}
@@ -71,30 +78,141 @@ func (Base *BaseAppService) ResponseSingleDto(c *gin.Context, obj1 interface{},
 	return
 }
 
+// ResponseListDto ResponseSingleDto 的列表版本，list 为实体切片或 PageListDto，dtos 为dto切片的指针
+// list 为 PageListDto 时只映射 Data，其余分页信息原样返回
+func (Base *BaseAppService) ResponseListDto(c *gin.Context, list interface{}, dtos interface{}) {
+	var page *PageListDto
+	switch v := list.(type) {
+	case PageListDto:
+		page = &v
+	case *PageListDto:
+		page = v
+	}
+	if page == nil {
+		if err := mapToDto(list, dtos); err != nil {
+			Base.ResponseError(c, err)
+			return
+		}
+		Base.ResponseSuccess(c, reflect.ValueOf(dtos).Elem().Interface())
+		return
+	}
+	if err := mapToDto(page.Data, dtos); err != nil {
+		Base.ResponseError(c, err)
+		return
+	}
+	result := *page
+	result.Data = reflect.ValueOf(dtos).Elem().Interface()
+	Base.ResponseSuccess(c, result)
+}
+
+// mapToDto 实体映射为dto，dto必须为指针，映射规则见 lzqpkg.Map
+func mapToDto(entity interface{}, dto interface{}) error {
+	return lzqpkg.Map(entity, dto)
+}
+
+func Respond(c *gin.Context, err error) {
+	if err == nil {
+		writeResponse(c, http.StatusOK, ResponseDto{Code: 0, Msg: "success"})
+		return
+	}
+	status, res := errorResponse(c, err)
+	writeResponse(c, status, res)
+}
+
+// errorResponse 按错误类型得到 http 状态码及响应，内部错误只记录日志，返回通用提示
+func errorResponse(c *gin.Context, err error) (int, ResponseDto) {
+	e := lzqerror.From(err)
+	if e.Kind == lzqerror.KindInternal {
+		// 内部错误可能包含sql、连接串等信息，只记录日志，返回通用提示
+		lzqpkg.LogError(fmt.Sprintf("internal error, requestId: %v", GetRequestId(c)), err)
+		errorCode := e.Code
+		if len(errorCode) == 0 {
+			errorCode = lzqerror.KindInternal.String()
+		}
+		return e.Kind.HttpStatus(), ResponseDto{
+			Code:      e.Kind.ResponseCode(),
+			Msg:       internalErrorMsg,
+			ErrorCode: errorCode,
+		}
+	}
+	return e.Kind.HttpStatus(), ResponseDto{
+		Code:      e.Kind.ResponseCode(),
+		Msg:       e.Message,
+		ErrorCode: e.Code,
+		MsgKey:    e.MsgKey,
+		Details:   e.Details,
+	}
+}
+
+// ResponseError 同 Respond 按错误类型写入响应，然后 panic 中止请求（由 Recovery 捕获）
 func ResponseError(c *gin.Context, err error) {
-	var res ResponseDto
-	res.Code = 1
-	res.Msg = err.Error()
-	c.JSON(http.StatusInternalServerError, res)
+	status, res := errorResponse(c, err)
+	writeResponse(c, status, res)
 	panic(res)
 }
 
 type PageListDto struct {
-	TotalCount int64       `json:"totalCount"` //总条数
-	Data       interface{} `json:"data"`       //数据
+	TotalCount int64         `json:"totalCount"`           //总条数
+	Data       interface{}   `json:"data"`                 //数据，分组查询时为 []GroupItemDto
+	NextCursor string        `json:"nextCursor,omitempty"` //游标分页时下一页的游标，没有下一页时为空
+	GroupCount int64         `json:"groupCount,omitempty"` //分组查询时第一级分组的数量
+	Summary    []interface{} `json:"summary,omitempty"`    //totalSummary 的汇总结果，顺序与请求一致
 }
 type PageParamsDto struct {
 	RequireTotalCount bool   `form:"requireTotalCount"` //是否返回总条数
 	Skip              int    `form:"skip"`              //第几页，>=1开始
 	Take              int    `form:"take"`              //每页多少条数据
-	Sort              string `form:"sort"`              //排序字段 比如：[["name","contains"," 菜单管理"],["code","contains"," 菜单管理","or"]]
-	Filter            string `form:"filter"`            //查询条件
+	Sort              string `form:"sort"`              //排序字段 比如：[{"selector":"name","desc":true}]
+	Filter            string `form:"filter"`            //查询条件 比如：[["name","contains","菜单管理"],"or",[["code","=","menu"],"and",["isActive","=",true]]]
+	UseCursor         bool   `form:"useCursor"`         //是否使用游标分页，第一页传true
+	Cursor            string `form:"cursor"`            //游标分页时上一页返回的 nextCursor
+	Group             string `form:"group"`             //分组 比如：[{"selector":"deptId","desc":false,"isExpanded":false}]，只支持收起的分组，最后一级 isExpanded 为 true 时返回400，DevExtreme 需开启 remoteOperations.groupPaging
+	GroupSummary      string `form:"groupSummary"`      //分组汇总 比如：[{"selector":"amount","summaryType":"sum"}]
+	TotalSummary      string `form:"totalSummary"`      //总汇总，格式同 groupSummary
+	Select            string `form:"select"`            //返回的字段 比如：["name","code"]，为空时返回全部字段
+}
+
+// InvalidSelectorError 查询/排序字段未在dto中声明或禁止查询，可据此返回400
+type InvalidSelectorError struct {
+	Selector string
+}
+
+func (e *InvalidSelectorError) Error() string {
+	return fmt.Sprintf("不支持的查询字段：%v", e.Selector)
+}
+
+func (e *InvalidSelectorError) ErrorKind() lzqerror.Kind {
+	return lzqerror.KindValidation
+}
+
+func (e *InvalidSelectorError) ErrorCode() string {
+	return "invalid_selector"
+}
+
+// FilterValueError 查询条件值无法转换为字段类型，可据此返回400
+type FilterValueError struct {
+	Selector string
+	Value    interface{}
+	TypeName string // 期望的类型
+}
+
+func (e *FilterValueError) Error() string {
+	return fmt.Sprintf("查询字段 %v 的值 %v 不是有效的%v", e.Selector, e.Value, e.TypeName)
 }
+
+func (e *FilterValueError) ErrorKind() lzqerror.Kind {
+	return lzqerror.KindValidation
+}
+
+func (e *FilterValueError) ErrorCode() string {
+	return "invalid_filter_value"
+}
+
 type Filter struct {
-	Selector   string   `json:"selector"`
-	Operator   string   `json:"operator"`
-	Value      string   `json:"value"`
-	OrSelector []Filter `json:"orSelector"`
+	Selector   string      `json:"selector"`
+	Operator   string      `json:"operator"`
+	Value      interface{} `json:"value"`      // string、json.Number、bool、nil 或 []interface{}
+	OrSelector []Filter    `json:"orSelector"` // Deprecated: or 条件改用 FilterNode 表达
 }
 type Sort struct {
 	Selector string `json:"selector"`
@@ -103,200 +221,129 @@ type Sort struct {
 
 func DBCondition(inputDto PageParamsDto, dbSession *xorm.Session, tAlias string, structObj interface{}) error {
 	// 整理dto对应的数据库字段
-	tagMap := make(map[string]reflect.StructTag)
-	reflectStruct(structObj, tagMap)
+	fieldMap := make(map[string]reflect.StructField)
+	reflectStruct(structObj, fieldMap)
 	// 条件
-	var filters = make([]Filter, 0)
-	if len(inputDto.Filter) > 0 {
-		// [["name","contains"," 菜单管理"],["code","contains"," 菜单管理","or"]]
-		var filterArray [][]string
-		if err := json.Unmarshal([]byte(inputDto.Filter), &filterArray); err != nil {
-			return err
-		}
-
-		var lastFilter Filter
-		for i := 0; i < len(filterArray); {
-			lastFilter = Filter{
-				Selector: filterArray[i][0],
-				Operator: filterArray[i][1],
-				Value:    filterArray[i][2],
-			}
-			i++
-			for i < len(filterArray) {
-				if i > 0 && len(filterArray[i]) > 3 && filterArray[i][3] == "or" {
-					lastFilter.OrSelector = append(lastFilter.OrSelector, Filter{
-						Selector: filterArray[i][0],
-						Operator: filterArray[i][1],
-						Value:    filterArray[i][2],
-					})
-				} else {
-					break
-				}
-				i++
-			}
-			filters = append(filters, lastFilter)
-		}
-		operatorMap := make(map[string]string, 0)
-		operatorMap["="] = "="
-		operatorMap["in"] = "in"
-		operatorMap["not in"] = "not in"
-		operatorMap[">"] = ">"
-		operatorMap["<"] = "<"
-		operatorMap[">="] = ">="
-		operatorMap["<="] = "<="
-		operatorMap["contains"] = "like"
-
-		for _, f := range filters {
-			operator := ""
-			var isExist bool
-			if operator, isExist = operatorMap[strings.ToLower(f.Operator)]; !isExist {
-				return errors.New("不存在该条件操作符")
-			}
-			switch operator {
-			case "in", "not in":
-				vArr := strings.Split(f.Value, ",")
-				if len(f.OrSelector) > 0 {
-					var cond builder.Cond
-					if operator == "in" {
-						cond = builder.In(sqlField(tagMap, tAlias, f.Selector), vArr)
-					} else if operator == "not in" {
-						cond = builder.NotIn(sqlField(tagMap, tAlias, f.Selector), vArr)
-					}
-
-					for _, orf := range f.OrSelector {
-						operator := ""
-						var isExist bool
-						if operator, isExist = operatorMap[strings.ToLower(orf.Operator)]; !isExist {
-							return errors.New("不存在该条件操作符")
-						}
-						switch operator {
-						case "in":
-							vArr := strings.Split(orf.Value, ",")
-							cond = cond.Or(builder.In(sqlField(tagMap, tAlias, orf.Selector), vArr))
-						case "not in":
-							vArr := strings.Split(orf.Value, ",")
-							cond = cond.Or(builder.NotIn(sqlField(tagMap, tAlias, orf.Selector), vArr))
-						}
-					}
-					dbSession.Where(cond)
-				} else {
-					if operator == "in" {
-						dbSession.In(sqlField(tagMap, tAlias, f.Selector), vArr)
-					} else if operator == "not in" {
-						dbSession.NotIn(sqlField(tagMap, tAlias, f.Selector), vArr)
-					}
-				}
-			case "like":
-				if len(f.OrSelector) > 0 {
-					var v = make([]interface{}, 0)
-					wStr := fmt.Sprintf("%v %v ?", sqlField(tagMap, tAlias, f.Selector), operator)
-					v = append(v, "%"+f.Value+"%")
-					if orStr, orV, err := operatorTree(tagMap, tAlias, f.OrSelector, operatorMap); err != nil {
-						return err
-					} else {
-						wStr = wStr + orStr
-						v = append(v, orV...)
-					}
-					dbSession.Where(wStr, v...)
-				} else {
-					dbSession.And(fmt.Sprintf("%v %v ?", sqlField(tagMap, tAlias, f.Selector), operator), "%"+f.Value+"%")
-				}
-			default:
-				if len(f.OrSelector) > 0 {
-					var v = make([]interface{}, 0)
-					wStr := fmt.Sprintf("%v %v ?", sqlField(tagMap, tAlias, f.Selector), operator)
-					v = append(v, f.Value)
-					if orStr, orV, err := operatorTree(tagMap, tAlias, f.OrSelector, operatorMap); err != nil {
-						return err
-					} else {
-						wStr = wStr + orStr
-						v = append(v, orV...)
-					}
-					dbSession.Where(wStr, v...)
-				} else {
-					dbSession.And(fmt.Sprintf("%v %v ?", sqlField(tagMap, tAlias, f.Selector), operator), f.Value)
-				}
-			}
-		}
+	if err := applyFilter(inputDto, dbSession, tAlias, fieldMap); err != nil {
+		return err
 	}
 
 	// 排序
-	if inputDto.Sort != "" {
-		var sorts []Sort
-		if err := json.Unmarshal([]byte(inputDto.Sort), &sorts); err != nil {
+	sorts, err := parseSorts(inputDto, fieldMap)
+	if err != nil {
+		return err
+	}
+	if len(inputDto.Cursor) > 0 {
+		cond, err := cursorCond(inputDto.Cursor, sorts, fieldMap, tAlias)
+		if err != nil {
 			return err
 		}
-		for i := 0; i < len(sorts); i++ {
-			if sorts[i].Desc {
-				dbSession.Desc(sqlField(tagMap, tAlias, sorts[i].Selector))
-			} else {
-				dbSession.Asc(sqlField(tagMap, tAlias, sorts[i].Selector))
-			}
+		dbSession.And(cond)
+	}
+	for i := 0; i < len(sorts); i++ {
+		field, err := sqlField(fieldMap, tAlias, sorts[i].Selector)
+		if err != nil {
+			return err
+		}
+		if sorts[i].Desc {
+			dbSession.Desc(field)
+		} else {
+			dbSession.Asc(field)
 		}
 	}
+	// 返回字段
+	if err := applySelect(inputDto, dbSession, tAlias, fieldMap, sorts); err != nil {
+		return err
+	}
 
 	if inputDto.Take > 0 {
-		dbSession.Limit(inputDto.Take, inputDto.Skip)
+		if inputDto.IsCursorMode() {
+			// 游标分页不使用 skip
+			dbSession.Limit(inputDto.Take)
+		} else {
+			dbSession.Limit(inputDto.Take, inputDto.Skip)
+		}
 	}
 	return nil
 }
-func reflectStruct(structObj interface{}, tagMap map[string]reflect.StructTag) {
-	t := reflect.TypeOf(structObj)
-	v := reflect.ValueOf(structObj)
+
+// applyFilter 将查询条件加到 dbSession
+func applyFilter(inputDto PageParamsDto, dbSession *xorm.Session, tAlias string, fieldMap map[string]reflect.StructField) error {
+	if len(inputDto.Filter) == 0 {
+		return nil
+	}
+	node, err := ParseFilter(inputDto.Filter)
+	if err != nil {
+		return err
+	}
+	dbType := string(dbSession.Engine().Dialect().URI().DBType)
+	cond, err := buildFilterCond(node, fieldMap, tAlias, dbType)
+	if err != nil {
+		return err
+	}
+	if cond.IsValid() {
+		dbSession.And(cond)
+	}
+	return nil
+}
+func reflectStruct(structObj interface{}, fieldMap map[string]reflect.StructField) {
+	reflectStructType(reflect.TypeOf(structObj), nil, fieldMap)
+}
+
+// reflectStructType index 为上级字段的下标，保存的 StructField.Index 为相对于 structObj 的完整下标
+func reflectStructType(t reflect.Type, index []int, fieldMap map[string]reflect.StructField) {
 	if t.Kind() == reflect.Ptr {
 		t = t.Elem()
 	}
 	if t.Kind() != reflect.Struct {
 		lzqpkg.LogError("Check type error not Struct", nil)
+		return
 	}
 	fieldNum := t.NumField()
 	for i := 0; i < fieldNum; i++ {
 		f := t.Field(i)
+		f.Index = append(append([]int{}, index...), f.Index...)
+		if len(f.PkgPath) > 0 {
+			// 未导出字段不允许查询
+			continue
+		}
 		tags := f.Tag
-		if len(tags.Get("json")) > 0 {
-			tagMap[tags.Get("json")] = tags
+		jsonName := strings.Split(tags.Get("json"), ",")[0]
+		if jsonName == "-" {
+			continue
+		}
+		if len(jsonName) > 0 {
+			fieldMap[jsonName] = f
 		} else if f.Type.Kind() == reflect.Struct && tags.Get("xorm") == "extends" {
-			reflectStruct(v.Field(i).Interface(), tagMap)
+			reflectStructType(f.Type, f.Index, fieldMap)
 		} else {
-			tagMap[f.Name] = tags
+			fieldMap[f.Name] = f
 		}
 	}
 }
-func operatorTree(tagMap map[string]reflect.StructTag, tAlias string, filters []Filter, operatorMap map[string]string) (string, []interface{}, error) {
-	var wStr string
-	var v []interface{}
-	for _, f := range filters {
-		operator := ""
-		var isExist bool
-		if operator, isExist = operatorMap[strings.ToLower(f.Operator)]; !isExist {
-			return "", nil, errors.New("不存在该条件操作符")
-		}
-		switch operator {
-		case "like":
-			wStr = wStr + fmt.Sprintf(" or %v %v ?", sqlField(tagMap, tAlias, f.Selector), operator)
-			v = append(v, "%"+f.Value+"%")
-		default:
-			wStr = fmt.Sprintf(" or %v %v ?", sqlField(tagMap, tAlias, f.Selector), operator)
-			v = append(v, f.Value)
-		}
+
+// sqlField 查询/排序字段转为数据库字段，只允许dto中声明的字段，tag为 filter:"-" 的字段禁止查询
+func sqlField(fieldMap map[string]reflect.StructField, tAlias string, field string) (string, error) {
+	sf, t := fieldMap[field]
+	if !t || sf.Tag.Get("filter") == "-" {
+		return "", &InvalidSelectorError{Selector: field}
 	}
-	return wStr, v, nil
+	return dbField(sf, tAlias, field), nil
 }
-func sqlField(tagMap map[string]reflect.StructTag, tAlias string, field string) string {
-	if v, t := tagMap[field]; t {
-		f := field
-		if len(v.Get("tField")) > 0 {
-			f = v.Get("tField")
-		}
-		if len(v.Get("tAlias")) > 0 {
-			f = fmt.Sprintf("%v.%v", v.Get("tAlias"), f)
-		} else if len(tAlias) > 0 {
-			f = fmt.Sprintf("%v.%v", tAlias, f)
-		}
-		return f
-	} else {
-		return field
+
+// dbField dto字段对应的数据库字段，tField 指定字段名，tAlias 指定表别名
+func dbField(sf reflect.StructField, tAlias string, field string) string {
+	v := sf.Tag
+	f := field
+	if len(v.Get("tField")) > 0 {
+		f = v.Get("tField")
+	}
+	if len(v.Get("tAlias")) > 0 {
+		f = fmt.Sprintf("%v.%v", v.Get("tAlias"), f)
+	} else if len(tAlias) > 0 {
+		f = fmt.Sprintf("%v.%v", tAlias, f)
 	}
+	return f
 }
 
 // func GetCurrentUserGrantedOperation(c *gin.Context, operations []dto.OperationDto, isPermissionChecking ...bool) string {
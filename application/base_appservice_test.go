@@ -0,0 +1,135 @@
+package lzqapplication
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/8/6
+ * @Version 1.0.0
+ */
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"xorm.io/builder"
+)
+
+type SelectorTestBase struct {
+	CreatorId int64 `json:"creatorId"`
+}
+
+type selectorTestDto struct {
+	SelectorTestBase `xorm:"extends"`
+	Id               int64  `json:"id"`
+	Name             string `json:"name,omitempty"`
+	DeptName         string `json:"deptName" tAlias:"d" tField:"name"`
+	Password         string `json:"password" filter:"-"`
+	Ignored          string `json:"-"`
+	NoTag            string
+	internal         string
+}
+
+func TestSqlField(t *testing.T) {
+	fieldMap := make(map[string]reflect.StructField)
+	reflectStruct(&selectorTestDto{}, fieldMap)
+
+	tests := []struct {
+		selector string
+		want     string // 为空时应返回 InvalidSelectorError
+	}{
+		{"id", "t.id"},
+		{"name", "t.name"},
+		{"deptName", "d.name"},
+		{"creatorId", "t.creatorId"},
+		{"NoTag", "t.NoTag"},
+		{"password", ""},
+		{"Ignored", ""},
+		{"-", ""},
+		{"internal", ""},
+		{"Id", ""},
+		{"id;drop table t", ""},
+	}
+	for _, tt := range tests {
+		got, err := sqlField(fieldMap, "t", tt.selector)
+		if len(tt.want) == 0 {
+			if e, isSelectorErr := err.(*InvalidSelectorError); !isSelectorErr || e.Selector != tt.selector {
+				t.Errorf("selector %v: got %v, %v, want InvalidSelectorError", tt.selector, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("selector %v: got %v, %v, want %v", tt.selector, got, err, tt.want)
+		}
+	}
+
+	// extends 字段保存相对于 dto 的完整下标
+	if sf := fieldMap["creatorId"]; !reflect.DeepEqual(sf.Index, []int{0, 0}) {
+		t.Errorf("creatorId index: got %v, want [0 0]", sf.Index)
+	}
+}
+
+func TestFilterSelector(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   string // 为空时应返回 InvalidSelectorError
+	}{
+		{`["deptName","=","a"]`, `d.name = 'a'`},
+		{`["creatorId","=",1]`, `t.creatorId = 1`},
+		{`["password","=","a"]`, ``},
+		{`["unknown","=","a"]`, ``},
+		{`[["id","=",1],"or",["password","=","a"]]`, ``},
+		{`["!",["unknown","=","a"]]`, ``},
+	}
+	for _, tt := range tests {
+		got, err := filterSQL(tt.filter, selectorTestDto{}, builder.MYSQL)
+		if len(tt.want) == 0 {
+			if _, isSelectorErr := err.(*InvalidSelectorError); !isSelectorErr {
+				t.Errorf("filter %v: got %v, %v, want InvalidSelectorError", tt.filter, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("filter %v: got %v, %v, want %v", tt.filter, got, err, tt.want)
+		}
+	}
+}
+
+func TestResponseError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		msg    string
+	}{
+		{"invalid selector", &InvalidSelectorError{Selector: "x"}, http.StatusBadRequest, "不支持的查询字段：x"},
+		{"filter value", &FilterValueError{Selector: "id", Value: "a", TypeName: "整数"}, http.StatusBadRequest, "查询字段 id 的值 a 不是有效的整数"},
+		{"internal", errors.New("Error 1054: Unknown column 'x' in 'where clause'"), http.StatusInternalServerError, internalErrorMsg},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			func() {
+				defer func() {
+					if r := recover(); r == nil {
+						t.Error("want panic")
+					}
+				}()
+				ResponseError(c, tt.err)
+			}()
+			var res ResponseDto
+			if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+				t.Fatal(err)
+			}
+			if w.Code != tt.status || res.Msg != tt.msg {
+				t.Errorf("got %v %v, want %v %v", w.Code, res.Msg, tt.status, tt.msg)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package lzqapplication
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/10/22
+ * @Version 1.0.0
+ */
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/zhaohuawu/lzq-framework/lzqerror"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/zh"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	enTranslations "github.com/go-playground/validator/v10/translations/en"
+	zhTranslations "github.com/go-playground/validator/v10/translations/zh"
+)
+
+// FieldError 单个字段的校验错误，作为 ResponseDto.Details 返回
+type FieldError struct {
+	Field   string `json:"field"`           // 字段名，依次取 json/form/uri tag，嵌套字段如 items[0].name
+	Tag     string `json:"tag"`             // 校验规则，如 required
+	Param   string `json:"param,omitempty"` // 校验规则的参数，如 max=10 的 10
+	Message string `json:"message"`         // 按 Accept-Language 翻译的提示信息
+}
+
+// ErrValidation 参数校验失败，Details 为 []FieldError
+var ErrValidation = lzqerror.Validation("validation_failed", "参数校验失败")
+
+// ErrBind 参数格式错误，无法绑定到dto
+var ErrBind = lzqerror.Validation("bind_failed", "参数格式错误")
+
+var (
+	validatorOnce sync.Once
+	validate      *validator.Validate
+	translator    *ut.UniversalTranslator
+)
+
+// Validator 参数校验使用的 validator，可用于注册自定义校验规则
+func Validator() *validator.Validate {
+	validatorOnce.Do(func() {
+		validate = validator.New()
+		validate.SetTagName("binding")
+		validate.RegisterTagNameFunc(func(f reflect.StructField) string {
+			for _, tag := range []string{"json", "form", "uri"} {
+				if name := strings.Split(f.Tag.Get(tag), ",")[0]; len(name) > 0 && name != "-" {
+					return name
+				}
+			}
+			return f.Name
+		})
+		zhLocale := zh.New()
+		translator = ut.New(zhLocale, zhLocale, en.New())
+		zhTrans, _ := translator.GetTranslator("zh")
+		enTrans, _ := translator.GetTranslator("en")
+		if err := zhTranslations.RegisterDefaultTranslations(validate, zhTrans); err != nil {
+			panic(err)
+		}
+		if err := enTranslations.RegisterDefaultTranslations(validate, enTrans); err != nil {
+			panic(err)
+		}
+	})
+	return validate
+}
+
+// Bind 绑定路径参数（uri tag）、查询参数（form tag）及请求体（json/xml/表单）到 T，再统一校验（binding tag 同 gin）
+// 参数格式错误返回 ErrBind，校验失败返回 ErrValidation，可直接交给 Respond 返回400
+func Bind[T any](c *gin.Context) (T, error) {
+	var obj T
+	if len(c.Params) > 0 {
+		params := make(map[string][]string, len(c.Params))
+		for _, p := range c.Params {
+			params[p.Key] = []string{p.Value}
+		}
+		if err := binding.MapFormWithTag(&obj, params, "uri"); err != nil {
+			return obj, ErrBind.Wrap(err)
+		}
+	}
+	if err := binding.MapFormWithTag(&obj, c.Request.URL.Query(), "form"); err != nil {
+		return obj, ErrBind.Wrap(err)
+	}
+	if err := bindBody(c, &obj); err != nil {
+		return obj, err
+	}
+	return obj, Validate(c, obj)
+}
+
+// bindBody 按 Content-Type 绑定请求体，没有请求体时跳过
+func bindBody(c *gin.Context, obj interface{}) error {
+	if c.Request.Body == nil || c.Request.Body == http.NoBody || c.Request.Method == http.MethodGet {
+		return nil
+	}
+	var err error
+	switch c.ContentType() {
+	case binding.MIMEJSON:
+		decoder := json.NewDecoder(c.Request.Body)
+		if binding.EnableDecoderUseNumber {
+			decoder.UseNumber()
+		}
+		if binding.EnableDecoderDisallowUnknownFields {
+			decoder.DisallowUnknownFields()
+		}
+		if err = decoder.Decode(obj); errors.Is(err, io.EOF) {
+			err = nil
+		}
+	case binding.MIMEXML, binding.MIMEXML2:
+		if err = xml.NewDecoder(c.Request.Body).Decode(obj); errors.Is(err, io.EOF) {
+			err = nil
+		}
+	case binding.MIMEPOSTForm:
+		if err = c.Request.ParseForm(); err == nil {
+			err = binding.MapFormWithTag(obj, c.Request.PostForm, "form")
+		}
+	case binding.MIMEMultipartPOSTForm:
+		var form *multipart.Form
+		if form, err = c.MultipartForm(); err == nil {
+			err = binding.MapFormWithTag(obj, form.Value, "form")
+		}
+	case "":
+		return nil
+	default:
+		return lzqerror.Validation("unsupported_content_type", "不支持的请求体格式："+c.ContentType())
+	}
+	if err != nil {
+		return ErrBind.Wrap(err)
+	}
+	return nil
+}
+
+// Validate 按 binding tag 校验 obj，提示信息按请求头 Accept-Language 返回中文或英文
+func Validate(c *gin.Context, obj interface{}) error {
+	err := Validator().Struct(obj)
+	if err == nil {
+		return nil
+	}
+	var fieldErrors validator.ValidationErrors
+	if !errors.As(err, &fieldErrors) {
+		// obj 不是结构体等无法校验的情况
+		return ErrBind.Wrap(err)
+	}
+	trans, _ := translator.FindTranslator(acceptLanguages(c)...)
+	details := make([]FieldError, 0, len(fieldErrors))
+	messages := make([]string, 0, len(fieldErrors))
+	for _, fe := range fieldErrors {
+		field := fe.Namespace()
+		if i := strings.Index(field, "."); i >= 0 {
+			field = field[i+1:]
+		}
+		message := fe.Translate(trans)
+		details = append(details, FieldError{Field: field, Tag: fe.Tag(), Param: fe.Param(), Message: message})
+		messages = append(messages, message)
+	}
+	return ErrValidation.WithMessage(strings.Join(messages, "；")).WithDetails(details).Wrap(err)
+}
+
+// acceptLanguages 请求头 Accept-Language 中的语言，zh-CN 同时返回 zh
+func acceptLanguages(c *gin.Context) []string {
+	languages := make([]string, 0)
+	for _, item := range strings.Split(c.GetHeader("Accept-Language"), ",") {
+		lang := strings.TrimSpace(strings.Split(item, ";")[0])
+		if len(lang) == 0 {
+			continue
+		}
+		languages = append(languages, strings.ReplaceAll(lang, "-", "_"))
+		if i := strings.IndexAny(lang, "-_"); i > 0 {
+			languages = append(languages, lang[:i])
+		}
+	}
+	return languages
+}
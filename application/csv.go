@@ -0,0 +1,306 @@
+package lzqapplication
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/10/8
+ * @Version 1.0.0
+ */
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// csvFlushRows 每写入多少行刷新一次，大列表边写边发送
+const csvFlushRows = 1000
+
+// csvTimeLayout csv 中时间的格式
+const csvTimeLayout = "2006-01-02 15:04:05"
+
+// utf8Bom excel 打开 utf-8 的 csv 需要 bom，否则中文乱码
+var utf8Bom = []byte{0xEF, 0xBB, 0xBF}
+
+// tableColumn 导出的列
+type tableColumn struct {
+	name  string            // 表头
+	key   string            // json字段名，map 行的 key
+	index []int             // struct 行的字段下标
+	tag   reflect.StructTag // struct 行的字段tag
+}
+
+// rowWriter 逐行写入导出文件
+type rowWriter interface {
+	WriteHeader(names []string) error
+	WriteRow(values []reflect.Value) error
+	Flush() error
+	Close() error
+}
+
+// csvRowWriter 写入csv，开头写入 bom
+type csvRowWriter struct {
+	w *csv.Writer
+}
+
+func newCSVRowWriter(w io.Writer) (*csvRowWriter, error) {
+	if _, err := w.Write(utf8Bom); err != nil {
+		return nil, err
+	}
+	return &csvRowWriter{w: csv.NewWriter(w)}, nil
+}
+
+func (cw *csvRowWriter) WriteHeader(names []string) error {
+	return cw.w.Write(names)
+}
+
+func (cw *csvRowWriter) WriteRow(values []reflect.Value) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = textCellString(v)
+	}
+	return cw.w.Write(record)
+}
+
+func (cw *csvRowWriter) Flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+func (cw *csvRowWriter) Close() error {
+	return cw.Flush()
+}
+
+// csvRows 取出响应中的列表数据：ResponseDto.Data、PageListDto.Data 或切片本身，错误响应返回false
+func csvRows(obj interface{}) (reflect.Value, bool) {
+	if res, isRes := obj.(ResponseDto); isRes {
+		if res.Code != 0 {
+			return reflect.Value{}, false
+		}
+		obj = res.Data
+	}
+	if page, isPage := obj.(pageResult); isPage {
+		obj = page.pageData()
+	}
+	v := reflect.ValueOf(obj)
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return reflect.Value{}, false
+	}
+	return v, true
+}
+
+// writeCSV 写入csv，表头为dto的json字段名，select 返回的 map 行按 select 的顺序
+func writeCSV(c *gin.Context, status int, rows reflect.Value) {
+	c.Header("Content-Type", MIMECSV+"; charset=utf-8")
+	c.Status(status)
+	w, err := newCSVRowWriter(c.Writer)
+	if err != nil {
+		return
+	}
+	columns := rowColumns(rows, c.Query("select"))
+	_ = writeRows(c, w, columns, func(yield func(row reflect.Value) error) error {
+		for i := 0; i < rows.Len(); i++ {
+			if err := yield(rows.Index(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// writeRows 写入表头及 each 提供的每一行，每 csvFlushRows 行发送一次
+func writeRows(c *gin.Context, w rowWriter, columns []tableColumn, each func(yield func(row reflect.Value) error) error) error {
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.name
+	}
+	if err := w.WriteHeader(names); err != nil {
+		return err
+	}
+	values := make([]reflect.Value, len(columns))
+	count := 0
+	err := each(func(row reflect.Value) error {
+		for row.Kind() == reflect.Interface || row.Kind() == reflect.Ptr {
+			row = row.Elem()
+		}
+		for j, col := range columns {
+			values[j] = columnValue(row, col)
+		}
+		if err := w.WriteRow(values); err != nil {
+			return err
+		}
+		if count++; count%csvFlushRows == 0 {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// rowColumns 列表数据的列，struct 按字段顺序，map 按 selectParam 的顺序，其余 key 排在后面
+func rowColumns(rows reflect.Value, selectParam string) []tableColumn {
+	t := rows.Type().Elem()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Struct {
+		return structColumns(t, nil)
+	}
+
+	isKey := make(map[string]bool)
+	for i := 0; i < rows.Len() && len(isKey) == 0; i++ {
+		row := rows.Index(i)
+		for row.Kind() == reflect.Interface || row.Kind() == reflect.Ptr {
+			row = row.Elem()
+		}
+		if row.Kind() != reflect.Map {
+			continue
+		}
+		for _, k := range row.MapKeys() {
+			isKey[fmt.Sprint(k.Interface())] = true
+		}
+	}
+	keys := make([]string, 0, len(isKey))
+	for k := range isKey {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var selectors []string
+	_ = json.Unmarshal([]byte(selectParam), &selectors)
+
+	columns := make([]tableColumn, 0, len(keys))
+	for _, k := range append(selectors, keys...) {
+		if isKey[k] {
+			delete(isKey, k)
+			columns = append(columns, tableColumn{name: k, key: k})
+		}
+	}
+	return columns
+}
+
+// structColumns dto 的列，规则同 json 序列化：json 字段名，"-" 不导出，匿名及 xorm:"extends" 的结构体展开
+func structColumns(t reflect.Type, index []int) []tableColumn {
+	columns := make([]tableColumn, 0)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		f.Index = append(append([]int{}, index...), f.Index...)
+		if len(f.PkgPath) > 0 && !f.Anonymous {
+			continue
+		}
+		jsonName := strings.Split(f.Tag.Get("json"), ",")[0]
+		if jsonName == "-" {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if len(jsonName) == 0 && ft.Kind() == reflect.Struct && (f.Anonymous || f.Tag.Get("xorm") == "extends") {
+			columns = append(columns, structColumns(ft, f.Index)...)
+			continue
+		}
+		if len(f.PkgPath) > 0 {
+			continue
+		}
+		if len(jsonName) == 0 {
+			jsonName = f.Name
+		}
+		columns = append(columns, tableColumn{name: jsonName, key: jsonName, index: f.Index, tag: f.Tag})
+	}
+	return columns
+}
+
+// columnValue 一行中某列的值
+func columnValue(row reflect.Value, col tableColumn) reflect.Value {
+	switch row.Kind() {
+	case reflect.Struct:
+		if len(col.index) == 0 {
+			return reflect.Value{}
+		}
+		fv, err := row.FieldByIndexErr(col.index)
+		if err != nil {
+			// 嵌套的指针为空
+			return reflect.Value{}
+		}
+		return fv
+	case reflect.Map:
+		return row.MapIndex(reflect.ValueOf(col.key))
+	default:
+		return reflect.Value{}
+	}
+}
+
+// cellValue 去掉指针、接口，空值返回 false
+func cellValue(v reflect.Value) (reflect.Value, bool) {
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return v, false
+		}
+		v = v.Elem()
+	}
+	return v, v.IsValid()
+}
+
+// formulaPrefixes 以这些字符开头的文本在 excel 中会被当作公式（包括制表符、回车）
+const formulaPrefixes = "=+-@\t\r"
+
+// textCellString 文本单元格的值，非数字的值以公式字符开头时前面加 '，防止公式注入
+func textCellString(v reflect.Value) string {
+	s := cellString(v)
+	if len(s) == 0 || !strings.ContainsRune(formulaPrefixes, rune(s[0])) {
+		return s
+	}
+	if v, isValid := cellValue(v); isValid {
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return s
+		}
+	}
+	return "'" + s
+}
+
+func cellString(v reflect.Value) string {
+	v, isValid := cellValue(v)
+	if !isValid {
+		return ""
+	}
+	value := v.Interface()
+	switch x := value.(type) {
+	case time.Time:
+		if x.IsZero() {
+			return ""
+		}
+		return x.Format(csvTimeLayout)
+	case fmt.Stringer:
+		return x.String()
+	case []byte:
+		return string(x)
+	}
+	switch v.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		b, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Sprint(value)
+		}
+		return string(b)
+	default:
+		return fmt.Sprint(value)
+	}
+}
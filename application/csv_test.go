@@ -0,0 +1,40 @@
+package lzqapplication
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/10/8
+ * @Version 1.0.0
+ */
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestTextCellString(t *testing.T) {
+	formula := "=1+1"
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{"abc", "abc"},
+		{"", ""},
+		{"=HYPERLINK(\"x\")", "'=HYPERLINK(\"x\")"},
+		{"+1", "'+1"},
+		{"-1", "'-1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\t=1", "'\t=1"},
+		{"\r=1", "'\r=1"},
+		{"a=1", "a=1"},
+		{&formula, "'=1+1"},
+		{-5, "-5"},
+		{-1.5, "-1.5"},
+		{math.Inf(1), "+Inf"},
+	}
+	for _, tt := range tests {
+		if got := textCellString(reflect.ValueOf(tt.value)); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
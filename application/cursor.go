@@ -0,0 +1,217 @@
+package lzqapplication
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/8/27
+ * @Version 1.0.0
+ */
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/zhaohuawu/lzq-framework/config"
+	"github.com/zhaohuawu/lzq-framework/lzqerror"
+
+	"xorm.io/builder"
+)
+
+// 游标分页（keyset）：
+// 第一页传 useCursor=true，之后每页传上一页返回的 nextCursor，不再使用 skip。
+// 游标中保存上一页最后一行的排序字段值，查询时转换为 (k1 > v1) or (k1 = v1 and k2 > v2) ... 的条件。
+// 排序字段的值不能为空，最后一个排序字段需唯一；dto 中有 id 字段且排序中没有时自动追加 id 升序。
+
+// ErrInvalidCursor 游标签名校验失败或与当前排序不一致
+var ErrInvalidCursor = lzqerror.Validation("invalid_cursor", "分页游标无效或已过期")
+
+// cursorIdSelector 游标分页自动追加的唯一排序字段
+const cursorIdSelector = "id"
+
+type pageCursor struct {
+	Sort   string        `json:"s"` // 排序签名，排序变化后游标失效
+	Values []interface{} `json:"v"` // 上一页最后一行的排序字段值
+}
+
+// IsCursorMode 是否为游标分页
+func (p PageParamsDto) IsCursorMode() bool {
+	return p.UseCursor || len(p.Cursor) > 0
+}
+
+// parseSorts 解析排序，游标分页时补充唯一排序字段
+func parseSorts(inputDto PageParamsDto, fieldMap map[string]reflect.StructField) ([]Sort, error) {
+	sorts := make([]Sort, 0)
+	if err := unmarshalParam(inputDto.Sort, &sorts); err != nil {
+		return nil, err
+	}
+	if !inputDto.IsCursorMode() {
+		return sorts, nil
+	}
+	for _, s := range sorts {
+		if s.Selector == cursorIdSelector {
+			return sorts, nil
+		}
+	}
+	if _, isExist := fieldMap[cursorIdSelector]; isExist {
+		sorts = append(sorts, Sort{Selector: cursorIdSelector})
+	}
+	if len(sorts) == 0 {
+		return nil, lzqerror.Validation("cursor_sort_required", "游标分页必须指定排序字段")
+	}
+	return sorts, nil
+}
+
+func sortSignature(sorts []Sort) string {
+	items := make([]string, 0, len(sorts))
+	for _, s := range sorts {
+		if s.Desc {
+			items = append(items, s.Selector+":desc")
+		} else {
+			items = append(items, s.Selector+":asc")
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+// cursorCond 将游标转换为查询条件
+func cursorCond(cursor string, sorts []Sort, fieldMap map[string]reflect.StructField, tAlias string) (builder.Cond, error) {
+	c, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	if c.Sort != sortSignature(sorts) || len(c.Values) != len(sorts) {
+		return nil, ErrInvalidCursor
+	}
+
+	fields := make([]string, len(sorts))
+	values := make([]interface{}, len(sorts))
+	for i, s := range sorts {
+		if fields[i], err = sqlField(fieldMap, tAlias, s.Selector); err != nil {
+			return nil, err
+		}
+		if values[i], err = convertFilterValue(s.Selector, c.Values[i], fieldMap[s.Selector].Type); err != nil {
+			return nil, err
+		}
+		if values[i] == nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	ors := make([]builder.Cond, 0, len(sorts))
+	for i, s := range sorts {
+		ands := make([]builder.Cond, 0, i+1)
+		for j := 0; j < i; j++ {
+			ands = append(ands, builder.Expr(fmt.Sprintf("%v = ?", fields[j]), values[j]))
+		}
+		operator := ">"
+		if s.Desc {
+			operator = "<"
+		}
+		ands = append(ands, builder.Expr(fmt.Sprintf("%v %v ?", fields[i], operator), values[i]))
+		ors = append(ors, builder.And(ands...))
+	}
+	return builder.Or(ors...), nil
+}
+
+// NextCursor 根据本页最后一行生成下一页游标，lastRow 为 structObj 类型的dto
+func NextCursor(inputDto PageParamsDto, structObj interface{}, lastRow interface{}) (string, error) {
+	fieldMap := make(map[string]reflect.StructField)
+	reflectStruct(structObj, fieldMap)
+	sorts, err := parseSorts(inputDto, fieldMap)
+	if err != nil {
+		return "", err
+	}
+
+	v := reflect.ValueOf(lastRow)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", errors.New("lastRow不能为空")
+		}
+		v = v.Elem()
+	}
+	c := pageCursor{Sort: sortSignature(sorts), Values: make([]interface{}, 0, len(sorts))}
+	for _, s := range sorts {
+		fv, err := v.FieldByIndexErr(fieldMap[s.Selector].Index)
+		if err != nil {
+			return "", err
+		}
+		value := fv.Interface()
+		if t, isTime := value.(time.Time); isTime {
+			value = t.Format(time.RFC3339Nano)
+		}
+		c.Values = append(c.Values, value)
+	}
+	return encodeCursor(c)
+}
+
+// cursorSecret 游标签名密钥，优先使用 server.CursorSecret，未配置时使用 jwt.JwtSecret
+func cursorSecret() ([]byte, error) {
+	secret := config.LzqConfig.GetString("server.CursorSecret")
+	if len(secret) == 0 {
+		secret = config.LzqConfig.GetString("jwt.JwtSecret")
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("未配置分页游标签名密钥")
+	}
+	return []byte(secret), nil
+}
+
+func signCursor(payload []byte) ([]byte, error) {
+	secret, err := cursorSecret()
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return mac.Sum(nil), nil
+}
+
+// encodeCursor 游标格式：base64(payload).base64(hmac)
+func encodeCursor(c pageCursor) (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	sign, err := signCursor(payload)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(sign), nil
+}
+
+func decodeCursor(cursor string) (*pageCursor, error) {
+	parts := strings.Split(cursor, ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	sign, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	expected, err := signCursor(payload)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(sign, expected) {
+		return nil, ErrInvalidCursor
+	}
+
+	var c pageCursor
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
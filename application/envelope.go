@@ -0,0 +1,95 @@
+package lzqapplication
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/10/1
+ * @Version 1.0.0
+ */
+
+import (
+	"strings"
+	"time"
+
+	"github.com/zhaohuawu/lzq-framework/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EnvelopePolicy 响应的包装方式，配置项 server.ResponseEnvelope
+type EnvelopePolicy string
+
+const (
+	EnvelopeRaw     EnvelopePolicy = "raw"     // 成功时直接返回数据，错误时返回 ResponseDto（默认）
+	EnvelopeWrapped EnvelopePolicy = "wrapped" // 始终返回 ResponseDto
+	EnvelopeMeta    EnvelopePolicy = "meta"    // 始终返回 ResponseDto，并带 meta：请求ID、时间戳、分页信息
+)
+
+// ResponseMeta 响应的附加信息，EnvelopeMeta 时返回
+type ResponseMeta struct {
+	RequestId  string        `json:"requestId"`
+	Timestamp  int64         `json:"timestamp"`            //毫秒时间戳
+	TotalCount *int64        `json:"totalCount,omitempty"` //分页数据的总条数
+	NextCursor string        `json:"nextCursor,omitempty"` //游标分页时下一页的游标
+	GroupCount int64         `json:"groupCount,omitempty"` //分组查询时第一级分组的数量
+	Summary    []interface{} `json:"summary,omitempty"`    //totalSummary 的汇总结果
+}
+
+// pageResult 分页结果，EnvelopeMeta 时分页信息放入 meta，data 只返回数据
+type pageResult interface {
+	pageData() interface{}
+	fillMeta(meta *ResponseMeta)
+}
+
+var responseEnvelope EnvelopePolicy
+
+// SetResponseEnvelope 代码中指定响应的包装方式，优先于配置
+func SetResponseEnvelope(policy EnvelopePolicy) {
+	responseEnvelope = policy
+}
+
+// ResponseEnvelope 当前响应的包装方式
+func ResponseEnvelope() EnvelopePolicy {
+	if len(responseEnvelope) > 0 {
+		return responseEnvelope
+	}
+	switch policy := EnvelopePolicy(strings.ToLower(config.LzqConfig.GetString("server.ResponseEnvelope"))); policy {
+	case EnvelopeWrapped, EnvelopeMeta:
+		return policy
+	default:
+		return EnvelopeRaw
+	}
+}
+
+// writeResponse 按包装方式写入 ResponseDto
+func writeResponse(c *gin.Context, status int, res ResponseDto) {
+	if ResponseEnvelope() == EnvelopeMeta {
+		res.Meta = &ResponseMeta{RequestId: GetRequestId(c), Timestamp: time.Now().UnixMilli()}
+		if page, isPage := res.Data.(pageResult); isPage {
+			res.Data = page.pageData()
+			page.fillMeta(res.Meta)
+		}
+	}
+	renderResponse(c, status, res)
+}
+
+func (p PageListDto) pageData() interface{} {
+	return p.Data
+}
+
+func (p PageListDto) fillMeta(meta *ResponseMeta) {
+	totalCount := p.TotalCount
+	meta.TotalCount = &totalCount
+	meta.NextCursor = p.NextCursor
+	meta.GroupCount = p.GroupCount
+	meta.Summary = p.Summary
+}
+
+func (p *PageDto[T]) pageData() interface{} {
+	return p.data()
+}
+
+func (p *PageDto[T]) fillMeta(meta *ResponseMeta) {
+	totalCount := p.TotalCount
+	meta.TotalCount = &totalCount
+	meta.NextCursor = p.NextCursor
+}
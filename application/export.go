@@ -0,0 +1,127 @@
+package lzqapplication
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/10/15
+ * @Version 1.0.0
+ */
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"xorm.io/xorm"
+)
+
+// ExportFormat 导出的文件格式
+type ExportFormat string
+
+const (
+	ExportCSV  ExportFormat = "csv"
+	ExportXLSX ExportFormat = "xlsx"
+)
+
+// ExportOptions 导出参数
+type ExportOptions struct {
+	Format   ExportFormat      // 默认 csv
+	FileName string            // 下载的文件名，不含扩展名，默认 export
+	Headers  map[string]string // 覆盖表头，key 为dto的json字段名
+}
+
+// Export 按分页参数查询 TEntity 并映射为 TDto，逐行写入 csv/xlsx 文件返回，不把全部数据加载到内存
+// 条件、排序、select 同 QueryPage，忽略 Skip/Take
+// 表头优先取 options.Headers，其次为dto字段的 export tag，都没有时为json字段名；export:"-" 的字段不导出
+// 开始写入文件前出错时返回错误，由调用方响应；写入过程中出错时响应已发出，返回的错误只用于记录日志
+func Export[TEntity, TDto any](c *gin.Context, dbSession *xorm.Session, inputDto PageParamsDto, tAlias string, options ExportOptions) error {
+	var dto TDto
+	inputDto.Skip, inputDto.Take = 0, 0
+	if err := DBCondition(inputDto, dbSession, tAlias, dto); err != nil {
+		return err
+	}
+	fieldMap := make(map[string]reflect.StructField)
+	reflectStruct(dto, fieldMap)
+	selectors, err := parseSelect(inputDto, fieldMap)
+	if err != nil {
+		return err
+	}
+	columns := exportColumns(reflect.TypeOf(dto), selectors, options.Headers)
+
+	rows, err := dbSession.Rows(new(TEntity))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	fileName := options.FileName
+	if len(fileName) == 0 {
+		fileName = "export"
+	}
+	var w rowWriter
+	if options.Format == ExportXLSX {
+		c.Header("Content-Type", MIMEXLSX)
+		fileName += ".xlsx"
+		w, err = newXLSXRowWriter(c.Writer)
+	} else {
+		c.Header("Content-Type", MIMECSV+"; charset=utf-8")
+		fileName += ".csv"
+		w, err = newCSVRowWriter(c.Writer)
+	}
+	c.Header("Content-Disposition", "attachment; filename*=UTF-8''"+url.PathEscape(fileName))
+	c.Status(http.StatusOK)
+	if err != nil {
+		return err
+	}
+
+	return writeRows(c, w, columns, func(yield func(row reflect.Value) error) error {
+		for rows.Next() {
+			var entity TEntity
+			if err := rows.Scan(&entity); err != nil {
+				return err
+			}
+			var row TDto
+			if err := mapToDto(entity, &row); err != nil {
+				return err
+			}
+			if err := yield(reflect.ValueOf(row)); err != nil {
+				return err
+			}
+		}
+		return rows.Err()
+	})
+}
+
+// exportColumns 导出的列，指定了 selectors 时只导出所选字段并按其顺序
+func exportColumns(t reflect.Type, selectors []string, headers map[string]string) []tableColumn {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	all := make([]tableColumn, 0)
+	for _, col := range structColumns(t, nil) {
+		export := strings.TrimSpace(col.tag.Get("export"))
+		if export == "-" {
+			continue
+		}
+		if header, isExist := headers[col.key]; isExist {
+			col.name = header
+		} else if len(export) > 0 {
+			col.name = export
+		}
+		all = append(all, col)
+	}
+	if len(selectors) == 0 {
+		return all
+	}
+	columns := make([]tableColumn, 0, len(selectors))
+	for _, s := range selectors {
+		for _, col := range all {
+			if col.key == s {
+				columns = append(columns, col)
+				break
+			}
+		}
+	}
+	return columns
+}
@@ -0,0 +1,375 @@
+package lzqapplication
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/8/6
+ * @Version 1.0.0
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/zhaohuawu/lzq-framework/lzqerror"
+
+	"xorm.io/builder"
+)
+
+// FilterNodeType 条件树节点类型
+type FilterNodeType int
+
+const (
+	FilterNodeLeaf FilterNodeType = iota // 单个条件 ["name","contains","菜单"]
+	FilterNodeAnd                        // and 分组
+	FilterNodeOr                         // or 分组
+	FilterNodeNot                        // 取反 ["!",[...]]
+)
+
+// FilterNode 查询条件树
+// 前端（DevExtreme）格式：
+//
+//	单个条件：["name","contains","菜单"]，省略操作符时为 "="：["name","菜单"]
+//	分组：[["name","=","a"],"and",["code","=","b"]]，省略连接符时为 and；and 优先级高于 or
+//	取反：["!",["name","=","a"]]
+//	兼容旧格式：[["name","contains","菜单"],["code","contains","菜单","or"]]，带 "or" 的条件与前一个条件组成 or
+type FilterNode struct {
+	Type     FilterNodeType
+	Filter   Filter        // Type 为 FilterNodeLeaf 时有效
+	Children []*FilterNode // 分组/取反的子节点
+}
+
+var errFilterFormat = lzqerror.Validation("filter_format", "查询条件格式错误")
+
+// filterOperator 条件操作符，ignoreCase 为忽略大小写的变体（操作符前加 i，如 icontains）
+// between 的值为 [开始,结束]，isnull/isnotnull 忽略值
+type filterOperator struct {
+	op         string
+	ignoreCase bool
+}
+
+var filterOperators = map[string]filterOperator{
+	"=":            {op: "="},
+	"<>":           {op: "<>"},
+	"!=":           {op: "<>"},
+	">":            {op: ">"},
+	"<":            {op: "<"},
+	">=":           {op: ">="},
+	"<=":           {op: "<="},
+	"in":           {op: "in"},
+	"not in":       {op: "not in"},
+	"between":      {op: "between"},
+	"isnull":       {op: "isnull"},
+	"isnotnull":    {op: "isnotnull"},
+	"contains":     {op: "contains"},
+	"notcontains":  {op: "notcontains"},
+	"startswith":   {op: "startswith"},
+	"endswith":     {op: "endswith"},
+	"i=":           {op: "=", ignoreCase: true},
+	"i<>":          {op: "<>", ignoreCase: true},
+	"icontains":    {op: "contains", ignoreCase: true},
+	"inotcontains": {op: "notcontains", ignoreCase: true},
+	"istartswith":  {op: "startswith", ignoreCase: true},
+	"iendswith":    {op: "endswith", ignoreCase: true},
+}
+
+// ParseFilter 解析前端传入的查询条件，空条件返回nil
+func ParseFilter(filter string) (*FilterNode, error) {
+	if len(strings.TrimSpace(filter)) == 0 {
+		return nil, nil
+	}
+	node, _, err := parseFilterNode(json.RawMessage(filter))
+	return node, err
+}
+
+// parseFilterNode 解析一个节点，legacyOr 表示旧格式中带 "or" 标记的条件
+func parseFilterNode(raw json.RawMessage) (node *FilterNode, legacyOr bool, err error) {
+	var items []json.RawMessage
+	if err = json.Unmarshal(raw, &items); err != nil {
+		return nil, false, errFilterFormat
+	}
+	if len(items) == 0 {
+		return nil, false, nil
+	}
+	var first string
+	if json.Unmarshal(items[0], &first) != nil {
+		// 第一个元素不是字符串，说明是分组
+		node, err = parseFilterGroup(items)
+		return node, false, err
+	}
+	if first == "!" {
+		if len(items) != 2 {
+			return nil, false, errFilterFormat
+		}
+		child, _, err := parseFilterNode(items[1])
+		if err != nil {
+			return nil, false, err
+		}
+		if child == nil {
+			return nil, false, nil
+		}
+		return &FilterNode{Type: FilterNodeNot, Children: []*FilterNode{child}}, false, nil
+	}
+	return parseFilterLeaf(first, items)
+}
+
+func parseFilterLeaf(selector string, items []json.RawMessage) (*FilterNode, bool, error) {
+	f := Filter{Selector: selector, Operator: "="}
+	legacyOr := false
+	switch len(items) {
+	case 2:
+		if err := parseFilterValue(items[1], &f.Value); err != nil {
+			return nil, false, err
+		}
+		// ["name","isnull"] 无需条件值的操作符
+		if op, isString := f.Value.(string); isString {
+			if o, isExist := filterOperators[strings.ToLower(op)]; isExist && (o.op == "isnull" || o.op == "isnotnull") {
+				f.Operator, f.Value = op, nil
+			}
+		}
+	case 3, 4:
+		if err := json.Unmarshal(items[1], &f.Operator); err != nil {
+			return nil, false, errFilterFormat
+		}
+		if err := parseFilterValue(items[2], &f.Value); err != nil {
+			return nil, false, err
+		}
+		if len(items) == 4 {
+			var flag string
+			if err := json.Unmarshal(items[3], &flag); err != nil {
+				return nil, false, errFilterFormat
+			}
+			legacyOr = strings.ToLower(flag) == "or"
+		}
+	default:
+		return nil, false, errFilterFormat
+	}
+	if len(f.Selector) == 0 {
+		return nil, false, errFilterFormat
+	}
+	return &FilterNode{Type: FilterNodeLeaf, Filter: f}, legacyOr, nil
+}
+
+func parseFilterGroup(items []json.RawMessage) (*FilterNode, error) {
+	// orTerms 中每一项是一组 and 条件
+	orTerms := [][]*FilterNode{{}}
+	for _, item := range items {
+		var connector string
+		if json.Unmarshal(item, &connector) == nil {
+			switch strings.ToLower(connector) {
+			case "and":
+			case "or":
+				orTerms = append(orTerms, []*FilterNode{})
+			default:
+				return nil, errFilterFormat
+			}
+			continue
+		}
+		child, legacyOr, err := parseFilterNode(item)
+		if err != nil {
+			return nil, err
+		}
+		if child == nil {
+			continue
+		}
+		term := orTerms[len(orTerms)-1]
+		if legacyOr && len(term) > 0 {
+			last := term[len(term)-1]
+			if last.Type == FilterNodeOr {
+				last.Children = append(last.Children, child)
+			} else {
+				term[len(term)-1] = &FilterNode{Type: FilterNodeOr, Children: []*FilterNode{last, child}}
+			}
+			continue
+		}
+		orTerms[len(orTerms)-1] = append(term, child)
+	}
+
+	ors := make([]*FilterNode, 0, len(orTerms))
+	for _, term := range orTerms {
+		switch len(term) {
+		case 0:
+		case 1:
+			ors = append(ors, term[0])
+		default:
+			ors = append(ors, &FilterNode{Type: FilterNodeAnd, Children: term})
+		}
+	}
+	switch len(ors) {
+	case 0:
+		return nil, nil
+	case 1:
+		return ors[0], nil
+	default:
+		return &FilterNode{Type: FilterNodeOr, Children: ors}, nil
+	}
+}
+
+// parseFilterValue 解析条件值，数字保留为 json.Number，按字段类型转换时再处理
+func parseFilterValue(raw json.RawMessage, value *interface{}) error {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) > 0 && raw[0] == '{' {
+		return errFilterFormat
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(value); err != nil {
+		return errFilterFormat
+	}
+	return nil
+}
+
+// buildFilterCond 将条件树转换为 builder.Cond，dbType 为数据库类型（builder.MYSQL 等）
+func buildFilterCond(node *FilterNode, fieldMap map[string]reflect.StructField, tAlias string, dbType string) (builder.Cond, error) {
+	if node == nil {
+		return builder.NewCond(), nil
+	}
+	switch node.Type {
+	case FilterNodeLeaf:
+		return buildLeafCond(node.Filter, fieldMap, tAlias, dbType)
+	case FilterNodeNot:
+		if len(node.Children) != 1 {
+			return nil, errFilterFormat
+		}
+		cond, err := buildFilterCond(node.Children[0], fieldMap, tAlias, dbType)
+		if err != nil {
+			return nil, err
+		}
+		return builder.Not{cond}, nil
+	case FilterNodeAnd, FilterNodeOr:
+		conds := make([]builder.Cond, 0, len(node.Children))
+		for _, child := range node.Children {
+			cond, err := buildFilterCond(child, fieldMap, tAlias, dbType)
+			if err != nil {
+				return nil, err
+			}
+			conds = append(conds, cond)
+		}
+		if node.Type == FilterNodeAnd {
+			return builder.And(conds...), nil
+		}
+		return builder.Or(conds...), nil
+	default:
+		return nil, errFilterFormat
+	}
+}
+
+func buildLeafCond(f Filter, fieldMap map[string]reflect.StructField, tAlias string, dbType string) (builder.Cond, error) {
+	operator, isExist := filterOperators[strings.ToLower(f.Operator)]
+	if !isExist {
+		return nil, lzqerror.Validation("invalid_operator", fmt.Sprintf("不存在该条件操作符：%v", f.Operator))
+	}
+	field, err := sqlField(fieldMap, tAlias, f.Selector)
+	if err != nil {
+		return nil, err
+	}
+	fieldType := fieldMap[f.Selector].Type
+	switch operator.op {
+	case "in", "not in":
+		values, err := filterValues(f, fieldType)
+		if err != nil {
+			return nil, err
+		}
+		// 空列表的 In/NotIn 是无效条件，会被 And/Or 忽略，in 应查不到数据，not in 应不过滤
+		if len(values) == 0 {
+			if operator.op == "in" {
+				return builder.Expr("1=0"), nil
+			}
+			return builder.Expr("1=1"), nil
+		}
+		if operator.op == "in" {
+			return builder.In(field, values...), nil
+		}
+		return builder.NotIn(field, values...), nil
+	case "between":
+		values, err := filterValues(f, fieldType)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) != 2 || values[0] == nil || values[1] == nil {
+			return nil, &FilterValueError{Selector: f.Selector, Value: f.Value, TypeName: "区间[开始,结束]"}
+		}
+		return builder.Between{Col: field, LessVal: values[0], MoreVal: values[1]}, nil
+	case "isnull":
+		return builder.IsNull{field}, nil
+	case "isnotnull":
+		return builder.NotNull{field}, nil
+	case "contains", "notcontains", "startswith", "endswith":
+		// null 或非字符串的值会变成 like '%%' 等，直接返回错误
+		value, isString := f.Value.(string)
+		if !isString {
+			return nil, &FilterValueError{Selector: f.Selector, Value: f.Value, TypeName: "字符串"}
+		}
+		// postgres 中非字符串字段不能直接 like
+		t := fieldType
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if dbType == builder.POSTGRES && t.Kind() != reflect.String {
+			return nil, lzqerror.Validation("invalid_operator", fmt.Sprintf("字段 %v 不是字符串，不能使用条件操作符：%v", f.Selector, f.Operator))
+		}
+		return likeCond(field, operator, value, dbType), nil
+	}
+
+	value, err := filterValue(f, fieldType)
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		// ["name","=",null] 等同于 isnull
+		switch operator.op {
+		case "=":
+			return builder.IsNull{field}, nil
+		case "<>":
+			return builder.NotNull{field}, nil
+		default:
+			return nil, &FilterValueError{Selector: f.Selector, Value: f.Value, TypeName: "非空值"}
+		}
+	}
+	if s, isString := value.(string); isString && operator.ignoreCase {
+		return builder.Expr(fmt.Sprintf("lower(%v) %v ?", field, operator.op), strings.ToLower(s)), nil
+	}
+	return builder.Expr(fmt.Sprintf("%v %v ?", field, operator.op), value), nil
+}
+
+// likeCond 生成 like 条件，转义用户输入中的通配符
+func likeCond(field string, operator filterOperator, value string, dbType string) builder.Cond {
+	pattern := escapeLike(value, dbType)
+	switch operator.op {
+	case "startswith":
+		pattern = pattern + "%"
+	case "endswith":
+		pattern = "%" + pattern
+	default:
+		pattern = "%" + pattern + "%"
+	}
+	like := "like"
+	if operator.op == "notcontains" {
+		like = "not like"
+	}
+	if operator.ignoreCase {
+		if dbType == builder.POSTGRES {
+			like = strings.Replace(like, "like", "ilike", 1)
+		} else {
+			field = fmt.Sprintf("lower(%v)", field)
+			pattern = strings.ToLower(pattern)
+		}
+	}
+	return builder.Expr(fmt.Sprintf("%v %v ? escape '%v'", field, like, likeEscapeChar), pattern)
+}
+
+// like 转义字符，使用 ! 避免 mysql 中反斜杠本身需要转义
+const likeEscapeChar = "!"
+
+func escapeLike(value string, dbType string) string {
+	value = strings.ReplaceAll(value, likeEscapeChar, likeEscapeChar+likeEscapeChar)
+	value = strings.ReplaceAll(value, "%", likeEscapeChar+"%")
+	value = strings.ReplaceAll(value, "_", likeEscapeChar+"_")
+	if dbType == builder.MSSQL {
+		// sqlserver 中 [ 也是通配符
+		value = strings.ReplaceAll(value, "[", likeEscapeChar+"[")
+	}
+	return value
+}
@@ -0,0 +1,82 @@
+package lzqapplication
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/8/9
+ * @Version 1.0.0
+ */
+
+import (
+	"testing"
+
+	"xorm.io/builder"
+)
+
+func TestFilterOperators(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   string
+	}{
+		{`["id","<>",1]`, `t.id <> 1`},
+		{`["id","!=",1]`, `t.id <> 1`},
+		{`["id",">=",1]`, `t.id >= 1`},
+		{`["id","<",1]`, `t.id < 1`},
+		{`["id","in",[1,2]]`, `t.id IN (1,2)`},
+		{`["id","in","1,2"]`, `t.id IN (1,2)`},
+		{`["id","not in",[1,2]]`, `t.id NOT IN (1,2)`},
+		{`["id","between",[1,2]]`, `t.id BETWEEN 1 AND 2`},
+		{`["name","isnotnull",null]`, `t.name IS NOT NULL`},
+		{`["name","startswith","a"]`, `t.name like 'a%' escape '!'`},
+		{`["name","endswith","a"]`, `t.name like '%a' escape '!'`},
+		{`["name","notcontains","a"]`, `t.name not like '%a%' escape '!'`},
+		{`["name","contains","50%_!"]`, `t.name like '%50!%!_!!%' escape '!'`},
+		{`["name","icontains","A"]`, `lower(t.name) like '%a%' escape '!'`},
+		{`["name","i=","A"]`, `lower(t.name) = 'a'`},
+		{`["name","CONTAINS","a"]`, `t.name like '%a%' escape '!'`},
+	}
+	for _, tt := range tests {
+		got, err := filterSQL(tt.filter, filterTestDto{}, builder.MYSQL)
+		if err != nil {
+			t.Errorf("filter %v: %v", tt.filter, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("filter %v\n got: %v\nwant: %v", tt.filter, got, tt.want)
+		}
+	}
+
+	// 不在白名单中的操作符
+	for _, filter := range []string{
+		`["name","like","a"]`,
+		`["name","= 1 or 1 =","a"]`,
+		`["name","regexp","a"]`,
+	} {
+		if _, err := filterSQL(filter, filterTestDto{}, builder.MYSQL); err == nil {
+			t.Errorf("filter %v: want invalid operator error", filter)
+		}
+	}
+
+	// like 操作符的值必须是字符串
+	for _, filter := range []string{
+		`["name","contains",null]`,
+		`["name","startswith",1]`,
+		`["name","endswith",["a"]]`,
+	} {
+		if _, err := filterSQL(filter, filterTestDto{}, builder.MYSQL); !isFilterValueError(err) {
+			t.Errorf("filter %v: got %v, want FilterValueError", filter, err)
+		}
+	}
+}
+
+func TestFilterOperatorsPostgres(t *testing.T) {
+	got, err := filterSQL(`["name","icontains","A"]`, filterTestDto{}, builder.POSTGRES)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `t.name ilike '%A%' escape '!'`; got != want {
+		t.Errorf("got: %v\nwant: %v", got, want)
+	}
+	if _, err := filterSQL(`["id","contains","1"]`, filterTestDto{}, builder.POSTGRES); err == nil {
+		t.Errorf("like on a non-string column: want error")
+	}
+}
@@ -0,0 +1,97 @@
+package lzqapplication
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/8/6
+ * @Version 1.0.0
+ */
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"xorm.io/builder"
+)
+
+type filterTestDto struct {
+	Id      int64     `json:"id"`
+	Name    string    `json:"name"`
+	Code    string    `json:"code"`
+	Enabled bool      `json:"enabled"`
+	Created time.Time `json:"created"`
+}
+
+// filterSQL 解析条件并生成带参数值的 sql
+func filterSQL(filter string, structObj interface{}, dbType string) (string, error) {
+	node, err := ParseFilter(filter)
+	if err != nil {
+		return "", err
+	}
+	fieldMap := make(map[string]reflect.StructField)
+	reflectStruct(structObj, fieldMap)
+	cond, err := buildFilterCond(node, fieldMap, "t", dbType)
+	if err != nil {
+		return "", err
+	}
+	return builder.ToBoundSQL(cond)
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter string
+		want   string
+	}{
+		{"empty", ``, ``},
+		{"empty array", `[]`, ``},
+		{"single", `["name","=","a"]`, `t.name = 'a'`},
+		{"default operator", `["name","a"]`, `t.name = 'a'`},
+		{"and", `[["name","=","a"],"and",["code","=","b"]]`, `(t.name = 'a') AND (t.code = 'b')`},
+		{"implicit and", `[["name","=","a"],["code","=","b"]]`, `(t.name = 'a') AND (t.code = 'b')`},
+		{"or", `[["name","=","a"],"or",["code","=","b"]]`, `(t.name = 'a') OR (t.code = 'b')`},
+		{"and before or", `[["name","=","a"],"or",["code","=","b"],"and",["id",">",1]]`, `(t.name = 'a') OR ((t.code = 'b') AND (t.id > 1))`},
+		{"nested", `[[["name","=","a"],"or",["name","=","b"]],"and",["id",">",1]]`, `((t.name = 'a') OR (t.name = 'b')) AND (t.id > 1)`},
+		{"negation", `["!",["name","=","a"]]`, `NOT t.name = 'a'`},
+		{"negated group", `["!",[["name","=","a"],"or",["code","=","b"]]]`, `NOT ((t.name = 'a') OR (t.code = 'b'))`},
+		{"legacy", `[["name","contains","a"],["code","=","b"]]`, `(t.name like '%a%' escape '!') AND (t.code = 'b')`},
+		{"legacy or", `[["name","=","a"],["code","=","b","or"],["id","=",1,"or"]]`, `(t.name = 'a') OR (t.code = 'b') OR (t.id = 1)`},
+		{"legacy or after and", `[["id",">",1],["name","=","a"],["code","=","b","or"]]`, `(t.id > 1) AND ((t.name = 'a') OR (t.code = 'b'))`},
+		{"isnull shorthand", `["name","isnull"]`, `t.name IS NULL`},
+		{"null equals", `["name","=",null]`, `t.name IS NULL`},
+		{"null not equals", `["name","<>",null]`, `t.name IS NOT NULL`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := filterSQL(tt.filter, filterTestDto{}, builder.MYSQL)
+			if err != nil {
+				t.Fatalf("filter %v: %v", tt.filter, err)
+			}
+			if got != tt.want {
+				t.Errorf("filter %v\n got: %v\nwant: %v", tt.filter, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFilterFormatError(t *testing.T) {
+	for _, filter := range []string{
+		`{"name":"a"}`,
+		`["name"]`,
+		`["name","=","a","b","c"]`,
+		`[["name","=","a"],"xor",["code","=","b"]]`,
+		`["!",["name","=","a"],["code","=","b"]]`,
+		`["name","=",{"a":1}]`,
+		`["","=","a"]`,
+		`not json`,
+	} {
+		if _, err := ParseFilter(filter); err != errFilterFormat {
+			t.Errorf("filter %v: got %v, want %v", filter, err, errFilterFormat)
+		}
+	}
+}
+
+func isFilterValueError(err error) bool {
+	_, isValueErr := err.(*FilterValueError)
+	return isValueErr
+}
@@ -0,0 +1,151 @@
+package lzqapplication
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/8/13
+ * @Version 1.0.0
+ */
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	uuidType = reflect.TypeOf(uuid.UUID{})
+)
+
+// 前端可能传入的时间格式
+var filterTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02 15:04",
+	"2006/01/02",
+}
+
+// filterValues in/not in 的值，支持json数组或逗号分隔的字符串
+func filterValues(f Filter, t reflect.Type) ([]interface{}, error) {
+	var items []interface{}
+	switch v := f.Value.(type) {
+	case []interface{}:
+		items = v
+	case string:
+		for _, s := range strings.Split(v, ",") {
+			items = append(items, s)
+		}
+	default:
+		items = []interface{}{v}
+	}
+	values := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		value, err := convertFilterValue(f.Selector, item, t)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// filterValue 单个条件值，按字段类型转换
+func filterValue(f Filter, t reflect.Type) (interface{}, error) {
+	if _, isArray := f.Value.([]interface{}); isArray {
+		return nil, &FilterValueError{Selector: f.Selector, Value: f.Value, TypeName: "单个值"}
+	}
+	return convertFilterValue(f.Selector, f.Value, t)
+}
+
+// filterString 条件值转为字符串
+func filterString(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+func convertFilterValue(selector string, value interface{}, t reflect.Type) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.TypeOf(value) == t {
+		return value, nil
+	}
+	str := filterString(value)
+	switch t {
+	case timeType:
+		s := strings.TrimSpace(str)
+		for _, layout := range filterTimeLayouts {
+			if v, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+				return v, nil
+			}
+		}
+		return nil, &FilterValueError{Selector: selector, Value: value, TypeName: "时间"}
+	case uuidType:
+		v, err := uuid.FromString(strings.TrimSpace(str))
+		if err != nil {
+			return nil, &FilterValueError{Selector: selector, Value: value, TypeName: "UUID"}
+		}
+		return v, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return str, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if _, isBool := value.(bool); isBool {
+			return nil, &FilterValueError{Selector: selector, Value: value, TypeName: "整数"}
+		}
+		v, err := strconv.ParseInt(strings.TrimSpace(str), 10, t.Bits())
+		if err != nil {
+			return nil, &FilterValueError{Selector: selector, Value: value, TypeName: "整数"}
+		}
+		return v, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if _, isBool := value.(bool); isBool {
+			return nil, &FilterValueError{Selector: selector, Value: value, TypeName: "非负整数"}
+		}
+		v, err := strconv.ParseUint(strings.TrimSpace(str), 10, t.Bits())
+		if err != nil {
+			return nil, &FilterValueError{Selector: selector, Value: value, TypeName: "非负整数"}
+		}
+		return v, nil
+	case reflect.Float32, reflect.Float64:
+		if _, isBool := value.(bool); isBool {
+			return nil, &FilterValueError{Selector: selector, Value: value, TypeName: "数字"}
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(str), t.Bits())
+		if err != nil {
+			return nil, &FilterValueError{Selector: selector, Value: value, TypeName: "数字"}
+		}
+		return v, nil
+	case reflect.Bool:
+		if v, isBool := value.(bool); isBool {
+			return v, nil
+		}
+		v, err := strconv.ParseBool(strings.TrimSpace(str))
+		if err != nil {
+			return nil, &FilterValueError{Selector: selector, Value: value, TypeName: "布尔值"}
+		}
+		return v, nil
+	default:
+		// 其他类型按原值传给数据库
+		if n, isNumber := value.(json.Number); isNumber {
+			return n.String(), nil
+		}
+		return value, nil
+	}
+}
@@ -0,0 +1,144 @@
+package lzqapplication
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/8/13
+ * @Version 1.0.0
+ */
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"xorm.io/builder"
+)
+
+func TestConvertFilterValue(t *testing.T) {
+	var (
+		intType    = reflect.TypeOf(int64(0))
+		int8Type   = reflect.TypeOf(int8(0))
+		intPtrType = reflect.TypeOf((*int)(nil))
+		uintType   = reflect.TypeOf(uint32(0))
+		floatType  = reflect.TypeOf(float64(0))
+		boolType   = reflect.TypeOf(false)
+		stringType = reflect.TypeOf("")
+	)
+	day := time.Date(2022, 8, 13, 0, 0, 0, 0, time.Local)
+	id := uuid.NewV4()
+
+	tests := []struct {
+		name  string
+		value interface{}
+		t     reflect.Type
+		want  interface{} // 为 nil 且 wantErr 为 false 时期望 nil
+		err   bool
+	}{
+		{"int from number", json.Number("12"), intType, int64(12), false},
+		{"int from string", " 12 ", intType, int64(12), false},
+		{"int pointer", json.Number("12"), intPtrType, int64(12), false},
+		{"int overflow", json.Number("300"), int8Type, nil, true},
+		{"int from float", json.Number("1.5"), intType, nil, true},
+		{"int from bool", true, intType, nil, true},
+		{"int from text", "abc", intType, nil, true},
+		{"uint", json.Number("7"), uintType, uint64(7), false},
+		{"uint negative", json.Number("-1"), uintType, nil, true},
+		{"float", json.Number("1.5"), floatType, 1.5, false},
+		{"float from string", "2.25", floatType, 2.25, false},
+		{"bool", true, boolType, true, false},
+		{"bool from string", "false", boolType, false, false},
+		{"bool from number", json.Number("1"), boolType, true, false},
+		{"bool from text", "yes", boolType, nil, true},
+		{"string from number", json.Number("12"), stringType, "12", false},
+		{"string from bool", true, stringType, "true", false},
+		{"time date", "2022-08-13", timeType, day, false},
+		{"time datetime", "2022-08-13 10:20:30", timeType, day.Add(10*time.Hour + 20*time.Minute + 30*time.Second), false},
+		{"time rfc3339", "2022-08-13T00:00:00Z", timeType, time.Date(2022, 8, 13, 0, 0, 0, 0, time.UTC), false},
+		{"time slash", "2022/08/13", timeType, day, false},
+		{"time invalid", "13/08/2022", timeType, nil, true},
+		{"uuid", id.String(), uuidType, id, false},
+		{"uuid invalid", "abc", uuidType, nil, true},
+		{"null", nil, intType, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := convertFilterValue("field", tt.value, tt.t)
+			if tt.err {
+				if e, isValueErr := err.(*FilterValueError); !isValueErr || e.Selector != "field" {
+					t.Fatalf("got %v, %v, want FilterValueError", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotTime, isTime := got.(time.Time); isTime {
+				if !gotTime.Equal(tt.want.(time.Time)) {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterValueSQL(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   string
+		err    bool
+	}{
+		{`["id","=","12"]`, `t.id = 12`, false},
+		{`["id","in",["1",2]]`, `t.id IN (1,2)`, false},
+		{`["enabled","=","true"]`, `t.enabled = true`, false},
+		{`["enabled","=",0]`, `t.enabled = false`, false},
+		{`["id","in",[]]`, `1=0`, false},
+		{`["id","not in",[]]`, `1=1`, false},
+		{`[["id","in",[]],"and",["name","=","a"]]`, `(1=0) AND (t.name = 'a')`, false},
+		{`[["id","not in",[]],"or",["name","=","a"]]`, `(1=1) OR (t.name = 'a')`, false},
+		{`["id","=","abc"]`, ``, true},
+		{`["id","in",[1,"abc"]]`, ``, true},
+		{`["id","=",[1,2]]`, ``, true},
+		{`["id","between",[1]]`, ``, true},
+		{`["id","between",[1,null]]`, ``, true},
+		{`["id",">",null]`, ``, true},
+		{`["created",">=","2022-13-01"]`, ``, true},
+		{`["enabled","=","yes"]`, ``, true},
+	}
+	for _, tt := range tests {
+		got, err := filterSQL(tt.filter, filterTestDto{}, builder.MYSQL)
+		if tt.err {
+			if !isFilterValueError(err) {
+				t.Errorf("filter %v: got %v, %v, want FilterValueError", tt.filter, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("filter %v: got %v, %v, want %v", tt.filter, got, err, tt.want)
+		}
+	}
+
+	// 时间按字段类型转换为 time.Time 后再绑定
+	node, err := ParseFilter(`["created",">=","2022-08-13"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fieldMap := make(map[string]reflect.StructField)
+	reflectStruct(filterTestDto{}, fieldMap)
+	cond, err := buildFilterCond(node, fieldMap, "t", builder.MYSQL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := builder.NewWriter()
+	if err := cond.WriteTo(w); err != nil {
+		t.Fatal(err)
+	}
+	if args := w.Args(); len(args) != 1 || !reflect.DeepEqual(args[0], time.Date(2022, 8, 13, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("created args: got %#v", args)
+	}
+}
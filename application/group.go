@@ -0,0 +1,446 @@
+package lzqapplication
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/9/3
+ * @Version 1.0.0
+ */
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zhaohuawu/lzq-framework/lzqerror"
+
+	"xorm.io/xorm"
+)
+
+// GroupDescriptor 分组参数
+type GroupDescriptor struct {
+	Selector   string `json:"selector"`
+	Desc       bool   `json:"desc"`
+	IsExpanded bool   `json:"isExpanded"` // 只支持最后一级为 false（不返回明细数据），展开后的数据由前端按分组条件另行查询
+}
+
+// SummaryDescriptor 汇总参数，summaryType：count、sum、avg、min、max
+type SummaryDescriptor struct {
+	Selector    string `json:"selector"`
+	SummaryType string `json:"summaryType"`
+}
+
+// GroupItemDto 分组结果
+type GroupItemDto struct {
+	Key     interface{}    `json:"key"`               //分组字段的值
+	Items   []GroupItemDto `json:"items"`             //下级分组，最后一级为null
+	Count   int64          `json:"count"`             //分组内的数据条数
+	Summary []interface{}  `json:"summary,omitempty"` //groupSummary 的汇总结果，顺序与请求一致
+}
+
+var summaryTypes = map[string]bool{"count": true, "sum": true, "avg": true, "min": true, "max": true}
+
+// IsGroupMode 是否为分组查询
+func (p PageParamsDto) IsGroupMode() bool {
+	return len(strings.TrimSpace(p.Group)) > 0
+}
+
+// QueryGroups 分组及汇总查询，过滤条件同 DBCondition，分组、汇总字段以 structObj 声明的字段为准
+// Data 为第一级分组（按 Skip/Take 分页），Summary 为 totalSummary 的结果，TotalCount 为数据总条数
+// 不分组只需 totalSummary 时 Data 为空，明细数据另用 QueryPage 查询
+// 只有一级分组且指定了 Take 时在数据库中分页，分组数量、总条数及 totalSummary 由窗口函数（over ()）在同一个查询中得到，
+// 需要数据库支持窗口函数（mysql 8.0+、postgres、sqlserver、oracle、sqlite 3.25+）；Skip 超出分组数量时本页为空，
+// 总条数、分组数量为 0；多级分组时查询全部分组后在内存中分页
+// 只支持收起的分组：最后一级 isExpanded 为 true 时需要在 items 中返回明细数据，不支持，返回400；
+// DevExtreme 开启 remoteOperations.groupPaging 后最后一级 isExpanded 为 false，展开时按分组条件另行请求明细
+// dbSession 需由调用方指定表、别名及关联，查询后不能再用于查询明细数据
+func QueryGroups(dbSession *xorm.Session, inputDto PageParamsDto, tAlias string, structObj interface{}) (*PageListDto, error) {
+	fieldMap := make(map[string]reflect.StructField)
+	reflectStruct(structObj, fieldMap)
+
+	var groups []GroupDescriptor
+	var groupSummaries, totalSummaries []SummaryDescriptor
+	if err := unmarshalParam(inputDto.Group, &groups); err != nil {
+		return nil, err
+	}
+	if err := unmarshalParam(inputDto.GroupSummary, &groupSummaries); err != nil {
+		return nil, err
+	}
+	if err := unmarshalParam(inputDto.TotalSummary, &totalSummaries); err != nil {
+		return nil, err
+	}
+	if len(groups) > 0 && groups[len(groups)-1].IsExpanded {
+		return nil, lzqerror.Validation("group_expanded", "分组查询只支持收起的分组，最后一级 isExpanded 须为 false（DevExtreme 需开启 remoteOperations.groupPaging）")
+	}
+	summaries := append(append([]SummaryDescriptor{}, groupSummaries...), totalSummaries...)
+
+	if err := applyFilter(inputDto, dbSession, tAlias, fieldMap); err != nil {
+		return nil, err
+	}
+	if len(groups) == 1 && inputDto.Take > 0 {
+		return queryGroupPage(dbSession, inputDto, fieldMap, tAlias, groups, groupSummaries, totalSummaries)
+	}
+	rows, err := queryGroupRows(dbSession, fieldMap, tAlias, groups, summaries, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// 按分组字段排序，相同的上级分组是连续的
+	root := &groupNode{accs: newSummaryAccs(summaries, fieldMap)}
+	for _, row := range rows {
+		leafAccs, count := rowSummaryAccs(row, "", summaries, fieldMap)
+		path := []*groupNode{root}
+		node := root
+		for level := range groups {
+			key := dbValueOf(row[fmt.Sprintf("g%v", level)], fieldMap[groups[level].Selector].Type)
+			last := len(node.children) - 1
+			if last < 0 || !reflect.DeepEqual(node.children[last].key, key) {
+				node.children = append(node.children, &groupNode{key: key, accs: newSummaryAccs(summaries, fieldMap)})
+				last++
+			}
+			node = node.children[last]
+			path = append(path, node)
+		}
+		for _, n := range path {
+			n.count += count
+			for i := range n.accs {
+				n.accs[i].merge(leafAccs[i])
+			}
+		}
+	}
+
+	page := &PageListDto{
+		TotalCount: root.count,
+		GroupCount: int64(len(root.children)),
+		Data:       make([]GroupItemDto, 0),
+	}
+	if len(totalSummaries) > 0 {
+		page.Summary = summaryResult(root.accs[len(groupSummaries):])
+	}
+	if len(groups) > 0 {
+		children := root.children
+		if inputDto.Skip > 0 {
+			if inputDto.Skip >= len(children) {
+				children = nil
+			} else {
+				children = children[inputDto.Skip:]
+			}
+		}
+		if inputDto.Take > 0 && inputDto.Take < len(children) {
+			children = children[:inputDto.Take]
+		}
+		page.Data = groupItems(children, len(groupSummaries))
+	}
+	return page, nil
+}
+
+// queryGroupPage 一级分组在数据库中分页，第一行的窗口函数列为分组数量、总条数及 totalSummary
+func queryGroupPage(dbSession *xorm.Session, inputDto PageParamsDto, fieldMap map[string]reflect.StructField, tAlias string, groups []GroupDescriptor, groupSummaries, totalSummaries []SummaryDescriptor) (*PageListDto, error) {
+	summaries := append(append([]SummaryDescriptor{}, groupSummaries...), totalSummaries...)
+	totals := make([]bool, len(summaries))
+	for i := len(groupSummaries); i < len(summaries); i++ {
+		totals[i] = true
+	}
+	dbSession.Limit(inputDto.Take, inputDto.Skip)
+	rows, err := queryGroupRows(dbSession, fieldMap, tAlias, groups, summaries, totals)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &PageListDto{Data: make([]GroupItemDto, 0)}
+	nodes := make([]*groupNode, 0, len(rows))
+	for _, row := range rows {
+		accs, count := rowSummaryAccs(row, "", summaries, fieldMap)
+		key := dbValueOf(row["g0"], fieldMap[groups[0].Selector].Type)
+		nodes = append(nodes, &groupNode{key: key, count: count, accs: accs})
+	}
+	page.Data = groupItems(nodes, len(groupSummaries))
+	if len(rows) > 0 {
+		page.GroupCount, _ = toInt64(rows[0]["wgcnt"])
+		accs, totalCount := rowSummaryAccs(rows[0], "w", summaries, fieldMap)
+		page.TotalCount = totalCount
+		if len(totalSummaries) > 0 {
+			page.Summary = summaryResult(accs[len(groupSummaries):])
+		}
+	}
+	return page, nil
+}
+
+func unmarshalParam(param string, v interface{}) error {
+	if len(strings.TrimSpace(param)) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(param), v); err != nil {
+		return errFilterFormat
+	}
+	return nil
+}
+
+// queryGroupRows 按全部分组字段查询各分组的条数及汇总的中间值
+// totals 不为空时为数据库分页，totals[i] 为 true 的汇总另用窗口函数计算全部分组的结果，列名加前缀 w
+func queryGroupRows(dbSession *xorm.Session, fieldMap map[string]reflect.StructField, tAlias string, groups []GroupDescriptor, summaries []SummaryDescriptor, totals []bool) ([]map[string]interface{}, error) {
+	columns := make([]string, 0)
+	groupBy := make([]string, 0, len(groups))
+	orderBy := make([]string, 0, len(groups))
+	for i, g := range groups {
+		field, err := sqlField(fieldMap, tAlias, g.Selector)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, fmt.Sprintf("%v as g%v", field, i))
+		groupBy = append(groupBy, field)
+		if g.Desc {
+			orderBy = append(orderBy, field+" desc")
+		} else {
+			orderBy = append(orderBy, field)
+		}
+	}
+	columns = append(columns, "count(*) as cnt")
+	if totals != nil {
+		columns = append(columns, "count(*) over () as wgcnt", "sum(count(*)) over () as wcnt")
+	}
+	for i, s := range summaries {
+		summaryType := strings.ToLower(s.SummaryType)
+		if !summaryTypes[summaryType] {
+			return nil, lzqerror.Validation("invalid_summary_type", fmt.Sprintf("不支持的汇总类型：%v", s.SummaryType))
+		}
+		if summaryType == "count" && len(s.Selector) == 0 {
+			continue
+		}
+		field, err := sqlField(fieldMap, tAlias, s.Selector)
+		if err != nil {
+			return nil, err
+		}
+		// count 指定字段时不统计 null
+		aggregates := make([][2]string, 0, 2)
+		switch summaryType {
+		case "count":
+			aggregates = append(aggregates, [2]string{fmt.Sprintf("count(%v)", field), "c"})
+		case "sum":
+			aggregates = append(aggregates, [2]string{fmt.Sprintf("sum(%v)", field), "s"})
+		case "avg":
+			aggregates = append(aggregates, [2]string{fmt.Sprintf("sum(%v)", field), "s"}, [2]string{fmt.Sprintf("count(%v)", field), "n"})
+		default:
+			aggregates = append(aggregates, [2]string{fmt.Sprintf("%v(%v)", summaryType, field), "v"})
+		}
+		for _, a := range aggregates {
+			columns = append(columns, fmt.Sprintf("%v as %v%v", a[0], a[1], i))
+			if totals != nil && totals[i] {
+				// 各分组结果再汇总：count、sum 求和，min、max 取最值
+				window := "sum"
+				if summaryType == "min" || summaryType == "max" {
+					window = summaryType
+				}
+				columns = append(columns, fmt.Sprintf("%v(%v) over () as w%v%v", window, a[0], a[1], i))
+			}
+		}
+	}
+
+	dbSession.Select(strings.Join(columns, ", "))
+	if len(groups) > 0 {
+		dbSession.GroupBy(strings.Join(groupBy, ", ")).OrderBy(strings.Join(orderBy, ", "))
+	}
+	rows, err := dbSession.QueryInterface()
+	if err != nil {
+		return nil, err
+	}
+	// oracle 等数据库返回的列名为大写
+	for i, row := range rows {
+		lower := make(map[string]interface{}, len(row))
+		for k, v := range row {
+			lower[strings.ToLower(k)] = v
+		}
+		rows[i] = lower
+	}
+	return rows, nil
+}
+
+type groupNode struct {
+	key      interface{}
+	count    int64
+	accs     []summaryAcc
+	children []*groupNode
+}
+
+func groupItems(nodes []*groupNode, groupSummaryNum int) []GroupItemDto {
+	items := make([]GroupItemDto, 0, len(nodes))
+	for _, n := range nodes {
+		item := GroupItemDto{Key: n.key, Count: n.count}
+		if len(n.children) > 0 {
+			item.Items = groupItems(n.children, groupSummaryNum)
+		}
+		if groupSummaryNum > 0 {
+			item.Summary = summaryResult(n.accs[:groupSummaryNum])
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// summaryAcc 汇总的中间值，上级分组由下级分组合并得到
+type summaryAcc struct {
+	summaryType string
+	fieldType   reflect.Type
+	count       int64   // count、avg
+	sum         float64 // sum、avg
+	value       interface{}
+	hasValue    bool
+}
+
+func newSummaryAccs(summaries []SummaryDescriptor, fieldMap map[string]reflect.StructField) []summaryAcc {
+	accs := make([]summaryAcc, len(summaries))
+	for i, s := range summaries {
+		accs[i].summaryType = strings.ToLower(s.SummaryType)
+		accs[i].fieldType = fieldMap[s.Selector].Type
+	}
+	return accs
+}
+
+// rowSummaryAccs 一行分组结果对应的汇总中间值，prefix 为列名前缀，w 为窗口函数计算的全部分组的结果
+func rowSummaryAccs(row map[string]interface{}, prefix string, summaries []SummaryDescriptor, fieldMap map[string]reflect.StructField) ([]summaryAcc, int64) {
+	count, _ := toInt64(row[prefix+"cnt"])
+	accs := newSummaryAccs(summaries, fieldMap)
+	for i := range accs {
+		acc := &accs[i]
+		switch acc.summaryType {
+		case "count":
+			acc.count, acc.hasValue = count, true
+			if v, isExist := row[fmt.Sprintf("%vc%v", prefix, i)]; isExist {
+				acc.count, _ = toInt64(v)
+			}
+		case "sum", "avg":
+			if v, ok := toFloat64(row[fmt.Sprintf("%vs%v", prefix, i)]); ok {
+				acc.sum, acc.hasValue = v, true
+			}
+			if acc.summaryType == "avg" {
+				acc.count, _ = toInt64(row[fmt.Sprintf("%vn%v", prefix, i)])
+			}
+		default:
+			if v := dbValueOf(row[fmt.Sprintf("%vv%v", prefix, i)], acc.fieldType); v != nil {
+				acc.value, acc.hasValue = v, true
+			}
+		}
+	}
+	return accs, count
+}
+
+func (acc *summaryAcc) merge(other summaryAcc) {
+	if !other.hasValue {
+		return
+	}
+	switch acc.summaryType {
+	case "count", "sum", "avg":
+		acc.count += other.count
+		acc.sum += other.sum
+	case "min":
+		if !acc.hasValue || compareValues(other.value, acc.value) < 0 {
+			acc.value = other.value
+		}
+	case "max":
+		if !acc.hasValue || compareValues(other.value, acc.value) > 0 {
+			acc.value = other.value
+		}
+	}
+	acc.hasValue = true
+}
+
+func summaryResult(accs []summaryAcc) []interface{} {
+	result := make([]interface{}, len(accs))
+	for i, acc := range accs {
+		switch {
+		case acc.summaryType == "count":
+			result[i] = acc.count
+		case !acc.hasValue:
+			result[i] = nil
+		case acc.summaryType == "sum":
+			result[i] = acc.sum
+		case acc.summaryType == "avg":
+			if acc.count > 0 {
+				result[i] = acc.sum / float64(acc.count)
+			}
+		default:
+			result[i] = acc.value
+		}
+	}
+	return result
+}
+
+// normalizeDbValue mysql 等驱动返回的字符串、decimal 为 []byte
+func normalizeDbValue(v interface{}) interface{} {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return v
+}
+
+// dbValueOf 数据库返回的值转为dto字段的类型，无法转换时保留原值
+func dbValueOf(v interface{}, t reflect.Type) interface{} {
+	v = normalizeDbValue(v)
+	if v == nil || t == nil {
+		return v
+	}
+	if converted, err := convertFilterValue("", v, t); err == nil {
+		return converted
+	}
+	return v
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	switch n := normalizeDbValue(v).(type) {
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	if n, ok := v.(int64); ok {
+		return n, true
+	}
+	f, ok := toFloat64(v)
+	return int64(f), ok
+}
+
+func compareValues(a, b interface{}) int {
+	if fa, ok := toFloat64(a); ok {
+		if fb, ok := toFloat64(b); ok {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			default:
+				return 0
+			}
+		}
+	}
+	if ta, ok := a.(time.Time); ok {
+		if tb, ok := b.(time.Time); ok {
+			switch {
+			case ta.Before(tb):
+				return -1
+			case ta.After(tb):
+				return 1
+			default:
+				return 0
+			}
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
@@ -0,0 +1,120 @@
+package lzqapplication
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/9/24
+ * @Version 1.0.0
+ */
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+
+	"github.com/zhaohuawu/lzq-framework/lzqerror"
+	"github.com/zhaohuawu/lzq-framework/lzqpkg"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIdHeader 请求ID的请求头/响应头
+const RequestIdHeader = "X-Request-Id"
+
+const requestIdKey = "RequestId"
+
+// RequestId 从请求头读取请求ID，没有时生成，并写入响应头
+func RequestId() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		GetRequestId(c)
+		c.Next()
+	}
+}
+
+// GetRequestId 当前请求的ID
+func GetRequestId(c *gin.Context) string {
+	if id := c.GetString(requestIdKey); len(id) > 0 {
+		return id
+	}
+	id := c.GetHeader(RequestIdHeader)
+	if len(id) == 0 || len(id) > 64 {
+		id = lzqpkg.UuidCreate()
+	}
+	c.Set(requestIdKey, id)
+	c.Header(RequestIdHeader, id)
+	return id
+}
+
+// internalErrorMsg 系统内部错误返回给客户端的提示，错误详情只记录日志
+const internalErrorMsg = "服务器内部错误"
+
+// Recovery 捕获 panic，替代 gin.Recovery
+// ResponseError 等框架 panic 已写入响应，只中止请求；panic(*lzqerror.Error) 按错误类型返回；
+// 其他 panic 记录堆栈后返回500，响应只写一次
+func Recovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestId := GetRequestId(c)
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			defer c.Abort()
+
+			switch v := r.(type) {
+			case ResponseDto:
+				if !c.Writer.Written() {
+					writeResponse(c, http.StatusInternalServerError, v)
+				}
+				return
+			case *lzqerror.Error:
+				// 系统内部错误按崩溃处理，记录堆栈
+				if v.Kind != lzqerror.KindInternal {
+					if !c.Writer.Written() {
+						Respond(c, v)
+					}
+					return
+				}
+			}
+
+			err, isErr := r.(error)
+			if !isErr {
+				err = fmt.Errorf("%v", r)
+			}
+			if isBrokenPipe(err) {
+				// 客户端已断开，无法再写入响应
+				lzqpkg.LogError(fmt.Sprintf("connection broken, requestId: %v, %v %v", requestId, c.Request.Method, c.Request.URL.Path), err)
+				return
+			}
+			logPanic(c, requestId, err)
+			if !c.Writer.Written() {
+				writeResponse(c, http.StatusInternalServerError, ResponseDto{
+					Code:      http.StatusInternalServerError,
+					Msg:       internalErrorMsg,
+					ErrorCode: lzqerror.KindInternal.String(),
+				})
+			}
+		}()
+		c.Next()
+	}
+}
+
+func logPanic(c *gin.Context, requestId string, err error) {
+	lzqpkg.LogError(fmt.Sprintf("panic recovered, requestId: %v, %v %v\n%s", requestId, c.Request.Method, c.Request.URL.Path, debug.Stack()), err)
+}
+
+func isBrokenPipe(err error) bool {
+	var opErr *net.OpError
+	if !errors.As(err, &opErr) {
+		return false
+	}
+	var syscallErr *os.SyscallError
+	if errors.As(opErr, &syscallErr) {
+		msg := strings.ToLower(syscallErr.Error())
+		return strings.Contains(msg, "broken pipe") || strings.Contains(msg, "connection reset by peer")
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package lzqapplication
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/10/8
+ * @Version 1.0.0
+ */
+
+import (
+	"encoding/xml"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zhaohuawu/lzq-framework/lzqpkg"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/gin-gonic/gin/render"
+)
+
+// MIMECSV csv 响应格式
+const MIMECSV = "text/csv"
+
+// negotiateFormats 支持的响应格式，第一个为默认格式
+var negotiateFormats = []string{
+	binding.MIMEJSON,
+	binding.MIMEXML,
+	binding.MIMEXML2,
+	binding.MIMEMSGPACK,
+	binding.MIMEMSGPACK2,
+	MIMECSV,
+}
+
+// NegotiateFormat 按请求头 Accept 选择响应格式，默认为 json
+// 只有排在最前面（q 值最大）的类型明确为其他支持的格式时才使用该格式，
+// 浏览器默认的 text/html,...,application/xml;q=0.9 及 */* 等通配仍返回 json
+func NegotiateFormat(c *gin.Context) string {
+	type accept struct {
+		mime string
+		q    float64
+	}
+	accepts := make([]accept, 0)
+	for _, item := range strings.Split(c.GetHeader("Accept"), ",") {
+		parts := strings.Split(item, ";")
+		mime := strings.ToLower(strings.TrimSpace(parts[0]))
+		if len(mime) == 0 {
+			continue
+		}
+		q := 1.0
+		for _, param := range parts[1:] {
+			if kv := strings.SplitN(strings.TrimSpace(param), "=", 2); len(kv) == 2 && kv[0] == "q" {
+				if v, err := strconv.ParseFloat(kv[1], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			accepts = append(accepts, accept{mime: mime, q: q})
+		}
+	}
+	sort.SliceStable(accepts, func(i, j int) bool { return accepts[i].q > accepts[j].q })
+
+	if len(accepts) > 0 {
+		for _, offer := range negotiateFormats {
+			if accepts[0].mime == offer {
+				return offer
+			}
+		}
+	}
+	return negotiateFormats[0]
+}
+
+// renderResponse 按协商的格式写入响应，csv 只用于成功返回的列表数据，其余情况返回 json
+func renderResponse(c *gin.Context, status int, obj interface{}) {
+	format := NegotiateFormat(c)
+	if format != binding.MIMEJSON {
+		obj = normalizePage(obj)
+	}
+	switch format {
+	case binding.MIMEXML, binding.MIMEXML2:
+		// map 等类型无法序列化为 xml，先序列化，失败时返回 json，避免 Render 时 panic
+		data, err := xml.Marshal(obj)
+		if err != nil {
+			lzqpkg.LogError("xml序列化失败，返回json", err)
+			c.JSON(status, obj)
+			return
+		}
+		c.Data(status, binding.MIMEXML+"; charset=utf-8", data)
+	case binding.MIMEMSGPACK, binding.MIMEMSGPACK2:
+		c.Render(status, render.MsgPack{Data: obj})
+	case MIMECSV:
+		if rows, isRows := csvRows(obj); isRows {
+			writeCSV(c, status, rows)
+			return
+		}
+		c.JSON(status, obj)
+	default:
+		c.JSON(status, obj)
+	}
+}
+
+// normalizePage PageDto 只有 json 序列化时处理 select，其他格式先转为 PageListDto
+func normalizePage(obj interface{}) interface{} {
+	type toPageListDto interface {
+		ToPageListDto() PageListDto
+	}
+	switch v := obj.(type) {
+	case toPageListDto:
+		return v.ToPageListDto()
+	case ResponseDto:
+		if p, isPage := v.Data.(toPageListDto); isPage {
+			v.Data = p.ToPageListDto()
+		}
+		return v
+	}
+	return obj
+}
@@ -0,0 +1,105 @@
+package lzqapplication
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/8/20
+ * @Version 1.0.0
+ */
+
+import (
+	"encoding/json"
+
+	"github.com/zhaohuawu/lzq-framework/lzqpkg"
+
+	"xorm.io/xorm"
+)
+
+// PageDto 强类型的分页结果，json结构与 PageListDto 一致
+type PageDto[T any] struct {
+	TotalCount int64  `json:"totalCount"`           //总条数
+	Data       []T    `json:"data"`                 //数据
+	NextCursor string `json:"nextCursor,omitempty"` //游标分页时下一页的游标
+
+	selected interface{} // 指定了 select 时只含所选字段的数据
+}
+
+// ToPageListDto 转为 PageListDto，指定了 select 时 Data 只含所选字段
+func (p *PageDto[T]) ToPageListDto() PageListDto {
+	return PageListDto{TotalCount: p.TotalCount, Data: p.data(), NextCursor: p.NextCursor}
+}
+
+// MarshalJSON 指定了 select 时 data 只输出所选字段
+func (p PageDto[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		TotalCount int64       `json:"totalCount"`
+		Data       interface{} `json:"data"`
+		NextCursor string      `json:"nextCursor,omitempty"`
+	}{p.TotalCount, p.data(), p.NextCursor})
+}
+
+func (p *PageDto[T]) data() interface{} {
+	if p.selected != nil {
+		return p.selected
+	}
+	return p.Data
+}
+
+// QueryPage 按分页参数查询 TEntity 并映射为 TDto
+// 查询、排序字段以 TDto 声明的字段为准；RequireTotalCount 为 true 时同时查询总条数（总条数查询不带排序和分页）
+// dbSession 需由调用方指定表、别名及关联，如 engine.Table("sys_user").Alias("u")
+// 游标分页时本页满 Take 条才返回 NextCursor，总条数为游标之后的剩余条数
+// 指定了 Select 时只查询所选字段，Data 中其余字段为零值，序列化及 ToPageListDto 时只输出所选字段
+func QueryPage[TEntity, TDto any](dbSession *xorm.Session, inputDto PageParamsDto, tAlias string) (*PageDto[TDto], error) {
+	var dto TDto
+	if err := DBCondition(inputDto, dbSession, tAlias, dto); err != nil {
+		return nil, err
+	}
+
+	page := &PageDto[TDto]{}
+	entities := make([]TEntity, 0)
+	if inputDto.RequireTotalCount {
+		totalCount, err := dbSession.FindAndCount(&entities)
+		if err != nil {
+			return nil, err
+		}
+		page.TotalCount = totalCount
+	} else if err := dbSession.Find(&entities); err != nil {
+		return nil, err
+	}
+
+	data, err := lzqpkg.MapSlice[TDto](entities)
+	if err != nil {
+		return nil, err
+	}
+	page.Data = data
+	if inputDto.IsCursorMode() && inputDto.Take > 0 && len(page.Data) == inputDto.Take {
+		nextCursor, err := NextCursor(inputDto, dto, page.Data[len(page.Data)-1])
+		if err != nil {
+			return nil, err
+		}
+		page.NextCursor = nextCursor
+	}
+	if len(inputDto.Select) > 0 {
+		selected, err := SelectRows(inputDto, dto, page.Data)
+		if err != nil {
+			return nil, err
+		}
+		if _, isMap := selected.([]map[string]interface{}); isMap {
+			page.selected = selected
+		}
+	}
+	return page, nil
+}
+
+// MapPageList 将分页结果的 Data 映射为 []TDto，总条数、游标、分组数量及汇总原样保留
+func MapPageList[TDto any](page PageListDto) (PageListDto, error) {
+	data, err := lzqpkg.MapSlice[TDto](page.Data)
+	if err != nil {
+		return page, err
+	}
+	if data == nil {
+		data = make([]TDto, 0)
+	}
+	page.Data = data
+	return page, nil
+}
@@ -0,0 +1,109 @@
+package lzqapplication
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/9/10
+ * @Version 1.0.0
+ */
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"xorm.io/xorm"
+)
+
+// parseSelect 解析返回字段，只允许dto中声明的字段
+func parseSelect(inputDto PageParamsDto, fieldMap map[string]reflect.StructField) ([]string, error) {
+	var selectors []string
+	if err := unmarshalParam(inputDto.Select, &selectors); err != nil {
+		return nil, err
+	}
+	for _, s := range selectors {
+		if _, isExist := fieldMap[s]; !isExist {
+			return nil, &InvalidSelectorError{Selector: s}
+		}
+	}
+	return selectors, nil
+}
+
+// applySelect 只查询 select 指定的字段，游标分页时同时查询排序字段用于生成下一页游标
+// 会替换调用方设置的 Select
+func applySelect(inputDto PageParamsDto, dbSession *xorm.Session, tAlias string, fieldMap map[string]reflect.StructField, sorts []Sort) error {
+	columns, err := selectColumns(inputDto, tAlias, fieldMap, sorts)
+	if err != nil || len(columns) == 0 {
+		return err
+	}
+	dbSession.Select(strings.Join(columns, ", "))
+	return nil
+}
+
+// selectColumns select 对应的数据库字段；tField 指定了字段名时以 json 名作为别名，
+// 查询结果的列名与未指定 tField 的字段一样为 json 名，实体按该列名映射，不会写入同名的其他字段
+func selectColumns(inputDto PageParamsDto, tAlias string, fieldMap map[string]reflect.StructField, sorts []Sort) ([]string, error) {
+	selectors, err := parseSelect(inputDto, fieldMap)
+	if err != nil || len(selectors) == 0 {
+		return nil, err
+	}
+	if inputDto.IsCursorMode() {
+		for _, s := range sorts {
+			selectors = append(selectors, s.Selector)
+		}
+	}
+	columns := make([]string, 0, len(selectors))
+	isSelected := make(map[string]bool)
+	for _, s := range selectors {
+		if isSelected[s] {
+			continue
+		}
+		isSelected[s] = true
+		sf := fieldMap[s]
+		column := dbField(sf, tAlias, s)
+		if len(sf.Tag.Get("tField")) > 0 {
+			column = fmt.Sprintf("%v AS %v", column, s)
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
+
+// SelectRows 按 select 参数只保留 rows 中指定的字段，rows 为 structObj 类型（或其指针）的切片
+// 指定了 select 时返回 []map[string]interface{}，否则原样返回 rows
+func SelectRows(inputDto PageParamsDto, structObj interface{}, rows interface{}) (interface{}, error) {
+	fieldMap := make(map[string]reflect.StructField)
+	reflectStruct(structObj, fieldMap)
+	selectors, err := parseSelect(inputDto, fieldMap)
+	if err != nil || len(selectors) == 0 {
+		return rows, err
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(rows))
+	if v.Kind() != reflect.Slice {
+		return nil, errors.New("rows必须为切片")
+	}
+	result := make([]map[string]interface{}, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		row := v.Index(i)
+		for row.Kind() == reflect.Ptr {
+			row = row.Elem()
+		}
+		if !row.IsValid() {
+			result = append(result, nil)
+			continue
+		}
+		m := make(map[string]interface{}, len(selectors))
+		for _, s := range selectors {
+			fv, err := row.FieldByIndexErr(fieldMap[s].Index)
+			if err != nil {
+				// 嵌套的指针为空
+				m[s] = nil
+				continue
+			}
+			m[s] = fv.Interface()
+		}
+		result = append(result, m)
+	}
+	return result, nil
+}
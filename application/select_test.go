@@ -0,0 +1,53 @@
+package lzqapplication
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/9/10
+ * @Version 1.0.0
+ */
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSelectColumns(t *testing.T) {
+	fieldMap := make(map[string]reflect.StructField)
+	reflectStruct(selectorTestDto{}, fieldMap)
+
+	tests := []struct {
+		name    string
+		input   PageParamsDto
+		sorts   []Sort
+		want    string
+		wantErr bool
+	}{
+		{"empty", PageParamsDto{}, nil, ``, false},
+		{"plain", PageParamsDto{Select: `["id","name"]`}, nil, `t.id, t.name`, false},
+		{"tField alias", PageParamsDto{Select: `["name","deptName"]`}, nil, `t.name, d.name AS deptName`, false},
+		{"extends", PageParamsDto{Select: `["creatorId"]`}, nil, `t.creatorId`, false},
+		{"duplicate", PageParamsDto{Select: `["id","id"]`}, nil, `t.id`, false},
+		{"cursor sorts", PageParamsDto{Select: `["name"]`, UseCursor: true}, []Sort{{Selector: "deptName"}, {Selector: "id"}}, `t.name, d.name AS deptName, t.id`, false},
+		{"sorts without cursor", PageParamsDto{Select: `["name"]`}, []Sort{{Selector: "id"}}, `t.name`, false},
+		{"unknown", PageParamsDto{Select: `["unknown"]`}, nil, ``, true},
+		{"not an array", PageParamsDto{Select: `"id"`}, nil, ``, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			columns, err := selectColumns(tt.input, "t", fieldMap, tt.sorts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %v, want error", columns)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(columns, ", "); got != tt.want {
+				t.Errorf("got: %v\nwant: %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package lzqapplication
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/10/15
+ * @Version 1.0.0
+ */
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// MIMEXLSX xlsx 响应格式
+const MIMEXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// xlsx 只有一个工作表，单元格使用内联字符串，不需要共享字符串表，可以边查询边写入
+var xlsxParts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+// xlsxRowWriter 写入xlsx，数字写为数字单元格，其余写为文本
+type xlsxRowWriter struct {
+	zw    *zip.Writer
+	sheet *bufio.Writer
+}
+
+func newXLSXRowWriter(w io.Writer) (*xlsxRowWriter, error) {
+	zw := zip.NewWriter(w)
+	for _, part := range xlsxParts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return nil, err
+		}
+	}
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	sheet := bufio.NewWriter(f)
+	if _, err := sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`); err != nil {
+		return nil, err
+	}
+	return &xlsxRowWriter{zw: zw, sheet: sheet}, nil
+}
+
+func (xw *xlsxRowWriter) WriteHeader(names []string) error {
+	values := make([]reflect.Value, len(names))
+	for i, name := range names {
+		values[i] = reflect.ValueOf(name)
+	}
+	return xw.WriteRow(values)
+}
+
+func (xw *xlsxRowWriter) WriteRow(values []reflect.Value) error {
+	xw.sheet.WriteString("<row>")
+	for _, v := range values {
+		if number, isNumber := xlsxNumber(v); isNumber {
+			xw.sheet.WriteString("<c><v>" + number + "</v></c>")
+			continue
+		}
+		xw.sheet.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+		if err := xml.EscapeText(xw.sheet, []byte(textCellString(v))); err != nil {
+			return err
+		}
+		xw.sheet.WriteString("</t></is></c>")
+	}
+	_, err := xw.sheet.WriteString("</row>")
+	return err
+}
+
+func (xw *xlsxRowWriter) Flush() error {
+	if err := xw.sheet.Flush(); err != nil {
+		return err
+	}
+	return xw.zw.Flush()
+}
+
+func (xw *xlsxRowWriter) Close() error {
+	if _, err := xw.sheet.WriteString("</sheetData></worksheet>"); err != nil {
+		return err
+	}
+	if err := xw.sheet.Flush(); err != nil {
+		return err
+	}
+	return xw.zw.Close()
+}
+
+// xlsxNumber 数字类型的值，超过 15 位有效数字的整数（如雪花id）及 NaN、±Inf 写为文本
+func xlsxNumber(v reflect.Value) (string, bool) {
+	v, isValid := cellValue(v)
+	if !isValid {
+		return "", false
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n := v.Int(); n < 1e15 && n > -1e15 {
+			return strconv.FormatInt(n, 10), true
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n := v.Uint(); n < 1e15 {
+			return strconv.FormatUint(n, 10), true
+		}
+	case reflect.Float32, reflect.Float64:
+		// NaN、±Inf 写入数字单元格文件会损坏，写为文本
+		if f := v.Float(); !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return strconv.FormatFloat(f, 'f', -1, 64), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,191 @@
+package lzqerror
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/9/17
+ * @Version 1.0.0
+ */
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Kind 错误类型，决定返回的http状态码及 ResponseDto.Code
+type Kind int
+
+const (
+	KindInternal     Kind = iota // 系统内部错误
+	KindValidation               // 参数校验失败
+	KindNotFound                 // 数据不存在
+	KindUnauthorized             // 未登录或登录失效
+	KindForbidden                // 没有权限
+	KindConflict                 // 数据冲突，如重复提交、版本不一致
+	KindBusiness                 // 业务规则不满足
+)
+
+var kindNames = map[Kind]string{
+	KindInternal:     "internal",
+	KindValidation:   "validation",
+	KindNotFound:     "not_found",
+	KindUnauthorized: "unauthorized",
+	KindForbidden:    "forbidden",
+	KindConflict:     "conflict",
+	KindBusiness:     "business",
+}
+
+func (k Kind) String() string {
+	if name, isExist := kindNames[k]; isExist {
+		return name
+	}
+	return kindNames[KindInternal]
+}
+
+// HttpStatus 错误类型对应的http状态码，业务错误与原 ResponseBusinessError 一致返回200
+func (k Kind) HttpStatus() int {
+	switch k {
+	case KindValidation:
+		return http.StatusBadRequest
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindUnauthorized:
+		return http.StatusUnauthorized
+	case KindForbidden:
+		return http.StatusForbidden
+	case KindConflict:
+		return http.StatusConflict
+	case KindBusiness:
+		return http.StatusOK
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// ResponseCode 错误类型对应的 ResponseDto.Code，0为成功，业务错误与原 ResponseBusinessError 一致为1
+func (k Kind) ResponseCode() int {
+	if k == KindBusiness {
+		return 1
+	}
+	return k.HttpStatus()
+}
+
+// Error 框架统一的错误类型
+type Error struct {
+	Kind    Kind
+	Code    string      // 稳定的错误码，供前端判断，如 user.not_found
+	MsgKey  string      // 多语言消息的key，为空时同 Code
+	Message string      // 错误提示信息
+	Details interface{} // 错误详情，如校验失败的字段
+	Err     error       // 原始错误
+}
+
+// ErrorKinder 自定义错误实现该接口即可映射为对应的错误类型及错误码
+type ErrorKinder interface {
+	ErrorKind() Kind
+	ErrorCode() string
+}
+
+func New(kind Kind, code, message string) *Error {
+	if len(code) == 0 {
+		code = kind.String()
+	}
+	return &Error{Kind: kind, Code: code, MsgKey: code, Message: message}
+}
+
+func Validation(code, message string) *Error {
+	return New(KindValidation, code, message)
+}
+
+func NotFound(code, message string) *Error {
+	return New(KindNotFound, code, message)
+}
+
+func Unauthorized(code, message string) *Error {
+	return New(KindUnauthorized, code, message)
+}
+
+func Forbidden(code, message string) *Error {
+	return New(KindForbidden, code, message)
+}
+
+func Conflict(code, message string) *Error {
+	return New(KindConflict, code, message)
+}
+
+func Business(code, message string) *Error {
+	return New(KindBusiness, code, message)
+}
+
+// Internal 包装系统内部错误
+func Internal(err error) *Error {
+	e := New(KindInternal, "", "")
+	e.Err = err
+	if err != nil {
+		e.Message = err.Error()
+	}
+	return e
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil && e.Err.Error() != e.Message {
+		return fmt.Sprintf("%v: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is 类型和错误码相同即认为是同一个错误，便于 errors.Is 判断 WithDetails 等复制后的错误
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Kind == e.Kind && t.Code == e.Code
+}
+
+// WithDetails 返回带错误详情的副本
+func (e *Error) WithDetails(details interface{}) *Error {
+	c := *e
+	c.Details = details
+	return &c
+}
+
+// WithMsgKey 返回指定多语言消息key的副本
+func (e *Error) WithMsgKey(msgKey string) *Error {
+	c := *e
+	c.MsgKey = msgKey
+	return &c
+}
+
+// WithMessage 返回指定错误提示信息的副本
+func (e *Error) WithMessage(message string) *Error {
+	c := *e
+	c.Message = message
+	return &c
+}
+
+// Wrap 返回包装了原始错误的副本
+func (e *Error) Wrap(err error) *Error {
+	c := *e
+	c.Err = err
+	return &c
+}
+
+// From 将任意错误转为 *Error，实现了 ErrorKinder 的错误按其类型转换，其余为系统内部错误
+func From(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	var kinder ErrorKinder
+	if errors.As(err, &kinder) {
+		e = New(kinder.ErrorKind(), kinder.ErrorCode(), err.Error())
+		e.Err = err
+		return e
+	}
+	return Internal(err)
+}
@@ -1,8 +1,6 @@
 package lzqpkg
 
 import (
-	"fmt"
-
 	"github.com/gin-gonic/gin"
 )
 
@@ -18,19 +16,5 @@ type redisUtil struct {
 var RedisUtil = redisUtil{}
 
 func (r *redisUtil) NewRedis(c *gin.Context, useMultiTenancy bool, cacheNames ...string) *RedisHelper {
-	prefixKey := ""
-	for i, v := range cacheNames {
-		if len(v) > 0 {
-			if i == 0 {
-				prefixKey = v
-			} else {
-				prefixKey = fmt.Sprintf("%v:%v", prefixKey, v)
-			}
-		}
-	}
-	return &RedisHelper{
-		ginCtx:            c,
-		isUseMultiTenancy: useMultiTenancy,
-		prefixKey:         prefixKey,
-	}
+	return &RedisHelper{cacheScope: newCacheScope(c, useMultiTenancy, cacheNames...)}
 }
@@ -8,10 +8,23 @@ package lzqpkg
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+	"xorm.io/xorm/names"
 )
 
+// time.Time 字段不展开，避免读取未导出字段
+var timeType = reflect.TypeOf(time.Time{})
+
 // StructToMap struct转为map
+// 需要按tag取key、处理指针及多级匿名字段时使用 StructToMapWithOptions
 func StructToMap(obj interface{}, oneSeries bool) map[string]interface{} {
 	t := reflect.TypeOf(obj)
 	v := reflect.ValueOf(obj)
@@ -20,7 +33,7 @@ func StructToMap(obj interface{}, oneSeries bool) map[string]interface{} {
 	for i := 0; i < t.NumField(); i++ {
 		fieldName := t.Field(i).Name
 		if oneSeries == true {
-			if v.Field(i).Kind() == reflect.Struct {
+			if v.Field(i).Kind() == reflect.Struct && v.Field(i).Type() != timeType {
 				m := StructToMap(v.Field(i).Interface(), false)
 				//fmt.Println(m)
 				for k, w := range m {
@@ -38,6 +51,131 @@ func StructToMap(obj interface{}, oneSeries bool) map[string]interface{} {
 	return data
 }
 
+// StructToMapOptions StructToMapWithOptions 的参数
+type StructToMapOptions struct {
+	TagName    string       // 作为key的tag：json、xorm、mapstructure，为空时使用字段名
+	OmitEmpty  bool         // 忽略所有零值字段，为false时只忽略tag中带 omitempty 的零值字段
+	NameMapper names.Mapper // TagName 为 xorm 且tag中没有指定列名时字段名转列名的规则，默认 names.SnakeMapper
+}
+
+// StructToMapWithOptions struct转为map，obj 可以为指针，空指针返回空map
+// tag为 "-" 的字段不输出，未导出的字段跳过；匿名字段（及其指针）、xorm:"extends"、mapstructure:",squash" 的字段逐级展开，同名时外层字段优先
+func StructToMapWithOptions(obj interface{}, options StructToMapOptions) map[string]interface{} {
+	data := make(map[string]interface{})
+	v := reflect.ValueOf(obj)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return data
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return data
+	}
+	if options.NameMapper == nil {
+		options.NameMapper = names.SnakeMapper{}
+	}
+	structToMap(v, options, data, make(map[string]bool))
+	return data
+}
+
+// structToMap isOuter 记录外层已输出的key，展开的字段不覆盖外层字段
+func structToMap(v reflect.Value, options StructToMapOptions, data map[string]interface{}, isOuter map[string]bool) {
+	t := v.Type()
+	embedded := make([]reflect.Value, 0)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key, tag := structMapKey(f, options)
+		if tag.skip {
+			continue
+		}
+		fv := v.Field(i)
+		if (f.Anonymous && !tag.named) || tag.squash {
+			for fv.Kind() == reflect.Ptr && !fv.IsNil() {
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Ptr && fv.Type().Elem().Kind() == reflect.Struct {
+				// 空指针的匿名字段不输出
+				continue
+			}
+			if fv.Kind() == reflect.Struct && fv.Type() != timeType {
+				embedded = append(embedded, fv)
+				continue
+			}
+		}
+		if len(f.PkgPath) > 0 {
+			continue
+		}
+		if (options.OmitEmpty || tag.omitEmpty) && fv.IsZero() {
+			continue
+		}
+		data[key] = fv.Interface()
+		isOuter[key] = true
+	}
+	for _, ev := range embedded {
+		inner := make(map[string]interface{})
+		structToMap(ev, options, inner, make(map[string]bool))
+		for k, w := range inner {
+			if !isOuter[k] {
+				data[k] = w
+				isOuter[k] = true
+			}
+		}
+	}
+}
+
+type structMapTag struct {
+	named     bool // tag 中指定了key
+	skip      bool
+	omitEmpty bool
+	squash    bool
+}
+
+// structMapKey 字段对应的key及tag选项
+func structMapKey(f reflect.StructField, options StructToMapOptions) (string, structMapTag) {
+	var tag structMapTag
+	if len(options.TagName) == 0 {
+		return f.Name, tag
+	}
+	value := f.Tag.Get(options.TagName)
+	if value == "-" {
+		tag.skip = true
+		return "", tag
+	}
+	key := ""
+	if options.TagName == "xorm" {
+		// xorm 的列名写在单引号中，如 xorm:"'user_name' varchar(50)"
+		for _, item := range strings.Fields(value) {
+			switch {
+			case item == "extends":
+				tag.squash = true
+			case len(item) > 2 && strings.HasPrefix(item, "'") && strings.HasSuffix(item, "'"):
+				key = item[1 : len(item)-1]
+			}
+		}
+		tag.named = len(key) > 0
+		if !tag.named {
+			key = options.NameMapper.Obj2Table(f.Name)
+		}
+		return key, tag
+	}
+	items := strings.Split(value, ",")
+	key = items[0]
+	for _, item := range items[1:] {
+		switch item {
+		case "omitempty":
+			tag.omitEmpty = true
+		case "squash", "inline":
+			tag.squash = true
+		}
+	}
+	tag.named = len(key) > 0
+	if !tag.named {
+		key = f.Name
+	}
+	return key, tag
+}
+
 // StructToJson struct转为json
 //这里对应的 N 和 A 不能为小写，首字母必须为大写，这样才可对外提供访问，具体 json 匹配是通过后面的 tag 标签进行匹配的，与 N 和 A 没有关系
 //tag 标签中 json 后面跟着的是字段名称，都是字符串类型，要求必须加上双引号，否则 golang 是无法识别它的类型
@@ -48,3 +186,518 @@ func StructToJson(obj interface{}) (string, error) {
 	}
 	return string(jsonBytes), nil
 }
+
+// 对象映射：按字段名（不区分大小写）或 json tag 匹配，dto 字段可用 mapper:"源字段名" 指定来源，mapper:"-" 不映射
+// 源对象的匿名字段及 xorm:"extends" 字段展开匹配；兼容 StructToMap，其他结构体字段也展开一级，优先级最低
+// 支持嵌套结构体、切片、map、指针，time.Time、uuid.UUID、数字与字符串互转，其余类型可用 RegisterConverter 注册
+// 每对类型的映射计划只生成一次并缓存
+
+// MapperTimeLayout 时间与字符串互转的格式
+const MapperTimeLayout = "2006-01-02 15:04:05"
+
+// 字符串转时间时支持的格式
+var mapperTimeLayouts = []string{MapperTimeLayout, time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"}
+
+var uuidType = reflect.TypeOf(uuid.UUID{})
+
+type mapperPair struct {
+	src reflect.Type
+	dst reflect.Type
+}
+
+// mapFunc 将 src 映射到 dst，dst 必须可赋值
+type mapFunc func(src, dst reflect.Value) error
+
+var (
+	mapperMu    sync.RWMutex
+	mapperPlans = make(map[mapperPair]mapFunc) // 值为nil表示无法映射
+	converters  = make(map[mapperPair]mapFunc)
+)
+
+// RegisterConverter 注册 TSrc 到 TDst 的转换，优先于内置的转换，应在启动时注册
+func RegisterConverter[TSrc, TDst any](converter func(src TSrc) (TDst, error)) {
+	pair := mapperPair{reflect.TypeOf((*TSrc)(nil)).Elem(), reflect.TypeOf((*TDst)(nil)).Elem()}
+	mapperMu.Lock()
+	defer mapperMu.Unlock()
+	converters[pair] = func(src, dst reflect.Value) error {
+		v, err := converter(src.Interface().(TSrc))
+		if err != nil {
+			return err
+		}
+		dst.Set(reflect.ValueOf(&v).Elem())
+		return nil
+	}
+	// 已生成的映射计划可能用到该转换
+	mapperPlans = make(map[mapperPair]mapFunc)
+}
+
+// Map 将 src 映射到 dst，dst 必须为非空指针；dst 中没有匹配到的字段保留原值
+func Map(src interface{}, dst interface{}) error {
+	dv := reflect.ValueOf(dst)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() {
+		return errors.New("dst必须为非空指针")
+	}
+	sv := reflect.ValueOf(src)
+	if !sv.IsValid() {
+		return nil
+	}
+	return mapValue(sv, dv.Elem())
+}
+
+// MapTo 将 src 映射为 T
+func MapTo[T any](src interface{}) (T, error) {
+	var dst T
+	err := Map(src, &dst)
+	return dst, err
+}
+
+// MapSlice 将切片 src 的每一项映射为 TDst，映射计划只取一次，结果切片一次分配
+func MapSlice[TDst any](src interface{}) ([]TDst, error) {
+	sv := reflect.ValueOf(src)
+	for sv.Kind() == reflect.Ptr || sv.Kind() == reflect.Interface {
+		if sv.IsNil() {
+			return nil, nil
+		}
+		sv = sv.Elem()
+	}
+	if !sv.IsValid() || (sv.Kind() == reflect.Slice && sv.IsNil()) {
+		return nil, nil
+	}
+	if sv.Kind() != reflect.Slice && sv.Kind() != reflect.Array {
+		return nil, errors.New("src必须为切片")
+	}
+	result := make([]TDst, sv.Len())
+	dv := reflect.ValueOf(result)
+	elemFn, err := getMapFunc(sv.Type().Elem(), dv.Type().Elem())
+	if err != nil {
+		return nil, err
+	}
+	for i := range result {
+		if err := elemFn(sv.Index(i), dv.Index(i)); err != nil {
+			return nil, fmt.Errorf("[%v]: %w", i, err)
+		}
+	}
+	return result, nil
+}
+
+func mapValue(src, dst reflect.Value) error {
+	fn, err := getMapFunc(src.Type(), dst.Type())
+	if err != nil {
+		return err
+	}
+	return fn(src, dst)
+}
+
+// getMapFunc 取缓存的映射计划，没有时生成
+func getMapFunc(src, dst reflect.Type) (mapFunc, error) {
+	pair := mapperPair{src, dst}
+	mapperMu.RLock()
+	fn, isExist := mapperPlans[pair]
+	mapperMu.RUnlock()
+	if !isExist {
+		mapperMu.Lock()
+		b := &mapperBuilder{building: make(map[mapperPair]*mapFunc)}
+		fn = b.build(src, dst)
+		mapperMu.Unlock()
+	}
+	if fn == nil {
+		return nil, unmappableError(src, dst)
+	}
+	return fn, nil
+}
+
+func unmappableError(src, dst reflect.Type) error {
+	return fmt.Errorf("无法将 %v 映射为 %v", src, dst)
+}
+
+// mapperBuilder 生成映射计划，调用时需持有 mapperMu 写锁
+type mapperBuilder struct {
+	building map[mapperPair]*mapFunc // 正在生成的计划，用于递归类型
+}
+
+func (b *mapperBuilder) build(src, dst reflect.Type) mapFunc {
+	pair := mapperPair{src, dst}
+	if fn, isExist := mapperPlans[pair]; isExist {
+		return fn
+	}
+	if ref, isBuilding := b.building[pair]; isBuilding {
+		// 递归类型，执行时计划已生成
+		return func(s, d reflect.Value) error {
+			if *ref == nil {
+				return unmappableError(src, dst)
+			}
+			return (*ref)(s, d)
+		}
+	}
+	ref := new(mapFunc)
+	b.building[pair] = ref
+	*ref = b.newMapFunc(src, dst)
+	delete(b.building, pair)
+	mapperPlans[pair] = *ref
+	return *ref
+}
+
+func (b *mapperBuilder) newMapFunc(src, dst reflect.Type) mapFunc {
+	if fn, isExist := converters[mapperPair{src, dst}]; isExist {
+		return fn
+	}
+	if src == dst {
+		return func(s, d reflect.Value) error {
+			d.Set(s)
+			return nil
+		}
+	}
+
+	switch {
+	case src.Kind() == reflect.Interface:
+		// 按实际类型映射
+		return func(s, d reflect.Value) error {
+			if s.IsNil() {
+				d.Set(reflect.Zero(d.Type()))
+				return nil
+			}
+			return mapValue(s.Elem(), d)
+		}
+	case dst.Kind() == reflect.Interface:
+		if !src.AssignableTo(dst) {
+			return nil
+		}
+		return func(s, d reflect.Value) error {
+			d.Set(s)
+			return nil
+		}
+	case dst.Kind() == reflect.Ptr:
+		return b.ptrFunc(src, dst)
+	case src.Kind() == reflect.Ptr:
+		elemFn := b.build(src.Elem(), dst)
+		if elemFn == nil {
+			return nil
+		}
+		return func(s, d reflect.Value) error {
+			if s.IsNil() {
+				d.Set(reflect.Zero(d.Type()))
+				return nil
+			}
+			return elemFn(s.Elem(), d)
+		}
+	case src == timeType || dst == timeType || src == uuidType || dst == uuidType:
+		return specialFunc(src, dst)
+	case src.Kind() == reflect.Struct && dst.Kind() == reflect.Struct:
+		return b.structFunc(src, dst)
+	case (src.Kind() == reflect.Slice || src.Kind() == reflect.Array) && dst.Kind() == reflect.Slice:
+		return b.sliceFunc(src, dst)
+	case src.Kind() == reflect.Map && dst.Kind() == reflect.Map:
+		return b.dictFunc(src, dst)
+	default:
+		return basicFunc(src, dst)
+	}
+}
+
+func (b *mapperBuilder) ptrFunc(src, dst reflect.Type) mapFunc {
+	elemType := dst.Elem()
+	if src.Kind() != reflect.Ptr {
+		elemFn := b.build(src, elemType)
+		if elemFn == nil {
+			return nil
+		}
+		return func(s, d reflect.Value) error {
+			p := reflect.New(elemType)
+			if err := elemFn(s, p.Elem()); err != nil {
+				return err
+			}
+			d.Set(p)
+			return nil
+		}
+	}
+	elemFn := b.build(src.Elem(), elemType)
+	if elemFn == nil {
+		return nil
+	}
+	return func(s, d reflect.Value) error {
+		if s.IsNil() {
+			d.Set(reflect.Zero(d.Type()))
+			return nil
+		}
+		p := reflect.New(elemType)
+		if err := elemFn(s.Elem(), p.Elem()); err != nil {
+			return err
+		}
+		d.Set(p)
+		return nil
+	}
+}
+
+// fieldMapping 一个字段的映射
+type fieldMapping struct {
+	name string
+	src  []int
+	dst  []int
+	fn   mapFunc
+}
+
+func (b *mapperBuilder) structFunc(src, dst reflect.Type) mapFunc {
+	srcFields := make(map[string]mapperField)
+	for _, f := range mapperFields(src, true) {
+		for _, name := range f.names {
+			if _, isExist := srcFields[name]; !isExist {
+				srcFields[name] = f
+			}
+		}
+	}
+	mappings := make([]fieldMapping, 0)
+	for _, df := range mapperFields(dst, false) {
+		names := df.names
+		if len(df.from) > 0 {
+			names = []string{df.from}
+		}
+		for _, name := range names {
+			sf, isExist := srcFields[name]
+			if !isExist {
+				continue
+			}
+			if fn := b.build(sf.typ, df.typ); fn != nil {
+				mappings = append(mappings, fieldMapping{name: df.names[0], src: sf.index, dst: df.index, fn: fn})
+			}
+			break
+		}
+	}
+	return func(s, d reflect.Value) error {
+		for _, m := range mappings {
+			var sv reflect.Value
+			if len(m.src) == 1 {
+				sv = s.Field(m.src[0])
+			} else {
+				var err error
+				if sv, err = s.FieldByIndexErr(m.src); err != nil {
+					// 匿名字段的指针为空
+					continue
+				}
+			}
+			var dv reflect.Value
+			if len(m.dst) == 1 {
+				dv = d.Field(m.dst[0])
+			} else {
+				dv = d.FieldByIndex(m.dst)
+			}
+			if err := m.fn(sv, dv); err != nil {
+				return fmt.Errorf("%v: %w", m.name, err)
+			}
+		}
+		return nil
+	}
+}
+
+func (b *mapperBuilder) sliceFunc(src, dst reflect.Type) mapFunc {
+	elemFn := b.build(src.Elem(), dst.Elem())
+	if elemFn == nil {
+		return nil
+	}
+	return func(s, d reflect.Value) error {
+		if s.Kind() == reflect.Slice && s.IsNil() {
+			d.Set(reflect.Zero(d.Type()))
+			return nil
+		}
+		n := s.Len()
+		out := reflect.MakeSlice(d.Type(), n, n)
+		for i := 0; i < n; i++ {
+			if err := elemFn(s.Index(i), out.Index(i)); err != nil {
+				return fmt.Errorf("[%v]: %w", i, err)
+			}
+		}
+		d.Set(out)
+		return nil
+	}
+}
+
+func (b *mapperBuilder) dictFunc(src, dst reflect.Type) mapFunc {
+	keyFn := b.build(src.Key(), dst.Key())
+	valueFn := b.build(src.Elem(), dst.Elem())
+	if keyFn == nil || valueFn == nil {
+		return nil
+	}
+	return func(s, d reflect.Value) error {
+		if s.IsNil() {
+			d.Set(reflect.Zero(d.Type()))
+			return nil
+		}
+		out := reflect.MakeMapWithSize(d.Type(), s.Len())
+		iter := s.MapRange()
+		for iter.Next() {
+			// 每个元素使用新的值，结构体中的切片、map、指针等字段不会被下一个元素沿用
+			key := reflect.New(dst.Key()).Elem()
+			value := reflect.New(dst.Elem()).Elem()
+			if err := keyFn(iter.Key(), key); err != nil {
+				return err
+			}
+			if err := valueFn(iter.Value(), value); err != nil {
+				return fmt.Errorf("[%v]: %w", iter.Key(), err)
+			}
+			out.SetMapIndex(key, value)
+		}
+		d.Set(out)
+		return nil
+	}
+}
+
+// specialFunc time.Time、uuid.UUID 与字符串互转
+func specialFunc(src, dst reflect.Type) mapFunc {
+	switch {
+	case src == timeType && dst.Kind() == reflect.String:
+		return func(s, d reflect.Value) error {
+			t := s.Interface().(time.Time)
+			if t.IsZero() {
+				d.SetString("")
+			} else {
+				d.SetString(t.Format(MapperTimeLayout))
+			}
+			return nil
+		}
+	case src.Kind() == reflect.String && dst == timeType:
+		return func(s, d reflect.Value) error {
+			str := strings.TrimSpace(s.String())
+			if len(str) == 0 {
+				d.Set(reflect.Zero(dst))
+				return nil
+			}
+			for _, layout := range mapperTimeLayouts {
+				if t, err := time.ParseInLocation(layout, str, time.Local); err == nil {
+					d.Set(reflect.ValueOf(t))
+					return nil
+				}
+			}
+			return fmt.Errorf("%v 不是有效的时间", str)
+		}
+	case src == uuidType && dst.Kind() == reflect.String:
+		return func(s, d reflect.Value) error {
+			d.SetString(s.Interface().(uuid.UUID).String())
+			return nil
+		}
+	case src.Kind() == reflect.String && dst == uuidType:
+		return func(s, d reflect.Value) error {
+			str := strings.TrimSpace(s.String())
+			if len(str) == 0 {
+				d.Set(reflect.Zero(dst))
+				return nil
+			}
+			u, err := uuid.FromString(str)
+			if err != nil {
+				return err
+			}
+			d.Set(reflect.ValueOf(u))
+			return nil
+		}
+	}
+	return basicFunc(src, dst)
+}
+
+// basicFunc 基本类型的转换
+func basicFunc(src, dst reflect.Type) mapFunc {
+	srcNumber, dstNumber := isNumberKind(src.Kind()), isNumberKind(dst.Kind())
+	switch {
+	case srcNumber && dst.Kind() == reflect.String:
+		return func(s, d reflect.Value) error {
+			d.SetString(fmt.Sprint(s.Interface()))
+			return nil
+		}
+	case src.Kind() == reflect.String && dstNumber:
+		return func(s, d reflect.Value) error {
+			str := strings.TrimSpace(s.String())
+			if len(str) == 0 {
+				d.Set(reflect.Zero(dst))
+				return nil
+			}
+			var err error
+			switch {
+			case d.CanInt():
+				var n int64
+				if n, err = strconv.ParseInt(str, 10, dst.Bits()); err == nil {
+					d.SetInt(n)
+				}
+			case d.CanUint():
+				var n uint64
+				if n, err = strconv.ParseUint(str, 10, dst.Bits()); err == nil {
+					d.SetUint(n)
+				}
+			default:
+				var n float64
+				if n, err = strconv.ParseFloat(str, dst.Bits()); err == nil {
+					d.SetFloat(n)
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("%v 不是有效的数字", str)
+			}
+			return nil
+		}
+	case srcNumber && dstNumber, src.Kind() == dst.Kind() && src.ConvertibleTo(dst):
+		return func(s, d reflect.Value) error {
+			d.Set(s.Convert(dst))
+			return nil
+		}
+	}
+	return nil
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Float64
+}
+
+// mapperField 参与映射的字段
+type mapperField struct {
+	names []string // 匹配用的名称（小写）：字段名、json名
+	from  string   // mapper tag 指定的源字段名（小写）
+	index []int
+	typ   reflect.Type
+}
+
+// mapperFields 结构体参与映射的字段，匿名字段及 xorm:"extends" 字段展开，外层字段优先
+// isSource 为源对象时指针匿名字段也展开，并把其他结构体字段展开一级放在最后
+func mapperFields(t reflect.Type, isSource bool) []mapperField {
+	type level struct {
+		t     reflect.Type
+		index []int
+	}
+	fields := make([]mapperField, 0)
+	nested := make([]level, 0)
+	for queue := []level{{t: t}}; len(queue) > 0; queue = queue[1:] {
+		l := queue[0]
+		for i := 0; i < l.t.NumField(); i++ {
+			f := l.t.Field(i)
+			index := append(append([]int{}, l.index...), i)
+			mapperTag := f.Tag.Get("mapper")
+			if mapperTag == "-" {
+				continue
+			}
+			ft := f.Type
+			if isSource && ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			isStruct := ft.Kind() == reflect.Struct && ft != timeType && ft != uuidType
+			if isStruct && (f.Anonymous || f.Tag.Get("xorm") == "extends") {
+				queue = append(queue, level{t: ft, index: index})
+				continue
+			}
+			if len(f.PkgPath) > 0 {
+				continue
+			}
+			mf := mapperField{names: []string{strings.ToLower(f.Name)}, from: strings.ToLower(mapperTag), index: index, typ: f.Type}
+			if jsonName := strings.Split(f.Tag.Get("json"), ",")[0]; len(jsonName) > 0 && jsonName != "-" {
+				mf.names = append(mf.names, strings.ToLower(jsonName))
+			}
+			fields = append(fields, mf)
+			if isSource && isStruct && len(l.index) == 0 {
+				nested = append(nested, level{t: ft, index: index})
+			}
+		}
+	}
+	for _, l := range nested {
+		for i := 0; i < l.t.NumField(); i++ {
+			f := l.t.Field(i)
+			if len(f.PkgPath) > 0 || f.Anonymous || f.Tag.Get("mapper") == "-" {
+				continue
+			}
+			fields = append(fields, mapperField{names: []string{strings.ToLower(f.Name)}, index: append(append([]int{}, l.index...), i), typ: f.Type})
+		}
+	}
+	return fields
+}
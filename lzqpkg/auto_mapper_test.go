@@ -0,0 +1,417 @@
+package lzqpkg
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2021/10/30
+ * @Version 1.0.0
+ */
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+type mapperTestBase struct {
+	Id      int64
+	Created time.Time
+}
+
+type mapperTestAddress struct {
+	City string
+}
+
+type mapperTestUser struct {
+	mapperTestBase
+	Name     string
+	Age      int32
+	Score    string
+	UserId   uuid.UUID
+	Address  *mapperTestAddress
+	Tags     []string
+	Extra    map[string]int
+	Remark   interface{}
+	password string
+}
+
+type mapperTestAddressDto struct {
+	City string
+}
+
+type mapperTestUserDto struct {
+	Id       string
+	Created  string
+	UserName string `mapper:"Name"`
+	Age      int64
+	Score    float64
+	UserId   string
+	Address  mapperTestAddressDto
+	City     string
+	Tags     []string
+	Extra    map[string]string
+	Remark   string
+	Password string `mapper:"-"`
+}
+
+func TestMap(t *testing.T) {
+	created := time.Date(2022, 8, 13, 10, 20, 30, 0, time.Local)
+	id := uuid.NewV4()
+	user := mapperTestUser{
+		mapperTestBase: mapperTestBase{Id: 7, Created: created},
+		Name:           "tom",
+		Age:            18,
+		Score:          " 9.5 ",
+		UserId:         id,
+		Address:        &mapperTestAddress{City: "beijing"},
+		Tags:           []string{"a", "b"},
+		Extra:          map[string]int{"x": 1},
+		Remark:         "hi",
+		password:       "secret",
+	}
+	var dto mapperTestUserDto
+	if err := Map(user, &dto); err != nil {
+		t.Fatal(err)
+	}
+	want := mapperTestUserDto{
+		Id:       "7",
+		Created:  "2022-08-13 10:20:30",
+		UserName: "tom",
+		Age:      18,
+		Score:    9.5,
+		UserId:   id.String(),
+		Address:  mapperTestAddressDto{City: "beijing"},
+		City:     "beijing",
+		Tags:     []string{"a", "b"},
+		Extra:    map[string]string{"x": "1"},
+		Remark:   "hi",
+	}
+	if !reflect.DeepEqual(dto, want) {
+		t.Errorf("got %+v\nwant %+v", dto, want)
+	}
+
+	// 反向映射
+	back, err := MapTo[mapperTestUser](struct {
+		Id      string
+		Created string
+		UserId  string
+		Address *mapperTestAddressDto
+	}{"7", "2022-08-13 10:20:30", id.String(), &mapperTestAddressDto{City: "beijing"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.Id != 7 || !back.Created.Equal(created) || back.UserId != id || back.Address == nil || back.Address.City != "beijing" {
+		t.Errorf("back: got %+v", back)
+	}
+}
+
+func TestMapValue(t *testing.T) {
+	day := time.Date(2022, 8, 13, 0, 0, 0, 0, time.Local)
+	id := uuid.NewV4()
+	n := 5
+	var nilInt *int
+	tests := []struct {
+		name    string
+		src     interface{}
+		dst     interface{} // 指向目标类型零值的指针
+		want    interface{}
+		wantErr bool
+	}{
+		{"int to string", 12, new(string), "12", false},
+		{"string to int", " 12 ", new(int8), int8(12), false},
+		{"string to int overflow", "300", new(int8), nil, true},
+		{"string to uint", "7", new(uint), uint(7), false},
+		{"empty string to int", "", new(int), 0, false},
+		{"string to float", "1.5", new(float32), float32(1.5), false},
+		{"invalid number", "abc", new(int), nil, true},
+		{"int to float", 3, new(float64), 3.0, false},
+		{"int to pointer", 5, new(*int64), func() *int64 { v := int64(5); return &v }(), false},
+		{"pointer to int", &n, new(int64), int64(5), false},
+		{"nil pointer", nilInt, new(int64), int64(0), false},
+		{"nil pointer to pointer", nilInt, new(*string), (*string)(nil), false},
+		{"time to string", day, new(string), "2022-08-13 00:00:00", false},
+		{"zero time to string", time.Time{}, new(string), "", false},
+		{"date string to time", "2022-08-13", new(time.Time), day, false},
+		{"rfc3339 string to time", "2022-08-13T00:00:00Z", new(time.Time), time.Date(2022, 8, 13, 0, 0, 0, 0, time.UTC), false},
+		{"invalid time", "13/08/2022", new(time.Time), nil, true},
+		{"uuid to string", id, new(string), id.String(), false},
+		{"string to uuid", id.String(), new(uuid.UUID), id, false},
+		{"empty string to uuid", "", new(uuid.UUID), uuid.Nil, false},
+		{"invalid uuid", "abc", new(uuid.UUID), nil, true},
+		{"array to slice", [2]int{1, 2}, new([]string), []string{"1", "2"}, false},
+		{"nil slice", []int(nil), new([]string), []string(nil), false},
+		{"slice item error", []string{"1", "x"}, new([]int), nil, true},
+		{"map", map[int]int{1: 2}, new(map[string]string), map[string]string{"1": "2"}, false},
+		{"nil map", map[int]int(nil), new(map[string]string), map[string]string(nil), false},
+		{"map value error", map[string]string{"a": "x"}, new(map[string]int), nil, true},
+		{"to interface", 1, new(interface{}), 1, false},
+		{"unmappable", true, new(int), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Map(tt.src, tt.dst)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("got %#v, want error", reflect.ValueOf(tt.dst).Elem())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := reflect.ValueOf(tt.dst).Elem().Interface()
+			if gotTime, isTime := got.(time.Time); isTime {
+				if !gotTime.Equal(tt.want.(time.Time)) {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	if err := Map(1, nil); err == nil {
+		t.Error("nil dst: want error")
+	}
+	var s string
+	if err := Map(1, s); err == nil {
+		t.Error("non-pointer dst: want error")
+	}
+}
+
+type mapperTestItem struct {
+	Name string
+	Tags []string
+	Next *mapperTestItem
+}
+
+type mapperTestItemDto struct {
+	Name string
+	Tags []string
+	Next *mapperTestItemDto
+}
+
+func TestMapDict(t *testing.T) {
+	// 每个元素使用新的值，前一个元素的切片、指针不会留在后一个元素中
+	src := map[string]mapperTestItem{
+		"a": {Name: "a", Tags: []string{"x"}, Next: &mapperTestItem{Name: "a1"}},
+		"b": {Name: "b"},
+		"c": {Name: "c", Tags: []string{"y"}},
+	}
+	var dst map[string]mapperTestItemDto
+	if err := Map(src, &dst); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]mapperTestItemDto{
+		"a": {Name: "a", Tags: []string{"x"}, Next: &mapperTestItemDto{Name: "a1"}},
+		"b": {Name: "b"},
+		"c": {Name: "c", Tags: []string{"y"}},
+	}
+	if !reflect.DeepEqual(dst, want) {
+		t.Errorf("got %+v\nwant %+v", dst, want)
+	}
+}
+
+type mapperTestTree struct {
+	Name     string
+	Children []mapperTestTree
+	Parent   *mapperTestTree
+}
+
+type mapperTestTreeDto struct {
+	Name     string
+	Children []mapperTestTreeDto
+	Parent   *mapperTestTreeDto
+}
+
+func TestMapRecursive(t *testing.T) {
+	root := &mapperTestTree{Name: "root"}
+	src := mapperTestTree{
+		Name:   "a",
+		Parent: root,
+		Children: []mapperTestTree{
+			{Name: "b", Children: []mapperTestTree{{Name: "c"}}},
+		},
+	}
+	dst, err := MapTo[mapperTestTreeDto](src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := mapperTestTreeDto{
+		Name:   "a",
+		Parent: &mapperTestTreeDto{Name: "root"},
+		Children: []mapperTestTreeDto{
+			{Name: "b", Children: []mapperTestTreeDto{{Name: "c"}}},
+		},
+	}
+	if !reflect.DeepEqual(dst, want) {
+		t.Errorf("got %+v\nwant %+v", dst, want)
+	}
+
+	// 链表
+	list := &mapperTestItem{Name: "1", Next: &mapperTestItem{Name: "2", Next: &mapperTestItem{Name: "3"}}}
+	listDto, err := MapTo[*mapperTestItemDto](list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := ""
+	for item := listDto; item != nil; item = item.Next {
+		names += item.Name
+	}
+	if names != "123" {
+		t.Errorf("list: got %v, want 123", names)
+	}
+}
+
+func TestMapPlanCache(t *testing.T) {
+	type src struct{ Id int }
+	type dst struct{ Id string }
+	pair := mapperPair{reflect.TypeOf(src{}), reflect.TypeOf(dst{})}
+	if err := Map(src{Id: 1}, &dst{}); err != nil {
+		t.Fatal(err)
+	}
+	mapperMu.RLock()
+	fn, isExist := mapperPlans[pair]
+	mapperMu.RUnlock()
+	if !isExist || fn == nil {
+		t.Fatal("plan: want cached")
+	}
+	if err := Map(src{Id: 2}, &dst{}); err != nil {
+		t.Fatal(err)
+	}
+	mapperMu.RLock()
+	again := mapperPlans[pair]
+	mapperMu.RUnlock()
+	if reflect.ValueOf(again).Pointer() != reflect.ValueOf(fn).Pointer() {
+		t.Error("plan: want reused")
+	}
+
+	// 无法映射的类型也缓存，值为nil
+	unmappable := mapperPair{reflect.TypeOf(true), reflect.TypeOf(0)}
+	var n int
+	if err := Map(true, &n); err == nil {
+		t.Fatal("bool to int: want error")
+	}
+	mapperMu.RLock()
+	fn, isExist = mapperPlans[unmappable]
+	mapperMu.RUnlock()
+	if !isExist || fn != nil {
+		t.Errorf("unmappable plan: got %v, %v, want cached nil", isExist, fn != nil)
+	}
+}
+
+type mapperTestMoney int64
+
+type mapperTestOrder struct {
+	Amount mapperTestMoney
+}
+
+type mapperTestOrderDto struct {
+	Amount string
+}
+
+func TestRegisterConverter(t *testing.T) {
+	// 注册前使用内置的数字转字符串
+	dto, err := MapTo[mapperTestOrderDto](mapperTestOrder{Amount: 1250})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dto.Amount != "1250" {
+		t.Errorf("builtin: got %v, want 1250", dto.Amount)
+	}
+
+	// 注册后清空已生成的映射计划，结构体字段使用注册的转换
+	RegisterConverter(func(src mapperTestMoney) (string, error) {
+		return fmt.Sprintf("%d.%02d", src/100, src%100), nil
+	})
+	RegisterConverter(func(src string) (mapperTestMoney, error) {
+		yuan, err := strconv.ParseFloat(src, 64)
+		if err != nil {
+			return 0, errors.New("金额格式错误")
+		}
+		return mapperTestMoney(yuan*100 + 0.5), nil
+	})
+	if dto, err = MapTo[mapperTestOrderDto](mapperTestOrder{Amount: 1250}); err != nil {
+		t.Fatal(err)
+	}
+	if dto.Amount != "12.50" {
+		t.Errorf("converter: got %v, want 12.50", dto.Amount)
+	}
+	order, err := MapTo[mapperTestOrder](mapperTestOrderDto{Amount: "3.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Amount != 320 {
+		t.Errorf("reverse converter: got %v, want 320", order.Amount)
+	}
+	// 转换返回的错误带字段名
+	if _, err = MapTo[mapperTestOrder](mapperTestOrderDto{Amount: "x"}); err == nil || err.Error() != "amount: 金额格式错误" {
+		t.Errorf("converter error: got %v", err)
+	}
+}
+
+func TestMapSlice(t *testing.T) {
+	users := []*mapperTestUser{{Name: "a", Age: 1}, nil, {Name: "c", Age: 3}}
+	dtos, err := MapSlice[mapperTestUserDto](users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dtos) != 3 || dtos[0].UserName != "a" || dtos[1].UserName != "" || dtos[2].Age != 3 {
+		t.Errorf("got %+v", dtos)
+	}
+	if dtos, err = MapSlice[mapperTestUserDto]([]mapperTestUser(nil)); err != nil || dtos != nil {
+		t.Errorf("nil slice: got %v, %v", dtos, err)
+	}
+	if _, err = MapSlice[mapperTestUserDto](mapperTestUser{}); err == nil {
+		t.Error("not a slice: want error")
+	}
+	if _, err = MapSlice[int]([]string{"1", "x"}); err == nil || err.Error() != `[1]: x 不是有效的数字` {
+		t.Errorf("item error: got %v", err)
+	}
+}
+
+func TestMapConcurrent(t *testing.T) {
+	// 并发生成、读取映射计划
+	type src struct {
+		Id    int
+		Items []mapperTestItem
+		Tree  mapperTestTree
+	}
+	type dst struct {
+		Id    string
+		Items []mapperTestItemDto
+		Tree  mapperTestTreeDto
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s := src{Id: i, Items: []mapperTestItem{{Name: "a", Next: &mapperTestItem{Name: "b"}}}, Tree: mapperTestTree{Name: "t"}}
+				var d dst
+				if err := Map(s, &d); err != nil {
+					errs <- err
+					return
+				}
+				if d.Id != strconv.Itoa(i) || d.Items[0].Next.Name != "b" || d.Tree.Name != "t" {
+					errs <- fmt.Errorf("got %+v", d)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,90 @@
+package lzqpkg
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/11/26
+ * @Version 1.0.0
+ */
+
+import (
+	"context"
+	"encoding"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Cache 缓存，RedisHelper、MemoryCache、TwoTierCache 均实现该接口，key 规则相同（缓存池、租户、缓存名称）
+// SGetCtx、GetOrLoadCtx 等泛型方法可用于任意实现，测试时可使用不依赖 Redis 的 MemoryCache
+type Cache interface {
+	// GetCtx 读取字符串，不存在时返回 ErrCacheMiss
+	GetCtx(c context.Context, key string) (string, error)
+	// SetCtx 写入缓存，expiration<=0 时使用默认过期时间
+	SetCtx(c context.Context, key string, value interface{}, expiration time.Duration) error
+	DeleteCtx(c context.Context, key string) error
+	// SSetCtx 值使用json序列化后写入，配合 SGetCtx、GetOrLoadCtx 使用
+	SSetCtx(c context.Context, key string, value interface{}, expiration time.Duration) error
+}
+
+var (
+	_ Cache = (*RedisHelper)(nil)
+	_ Cache = (*MemoryCache)(nil)
+	_ Cache = (*TwoTierCache)(nil)
+)
+
+// cacheScope 缓存key的范围：租户（来自请求的token）及缓存名称
+type cacheScope struct {
+	ginCtx            *gin.Context
+	isUseMultiTenancy bool
+	prefixKey         string
+}
+
+func newCacheScope(c *gin.Context, useMultiTenancy bool, cacheNames ...string) cacheScope {
+	prefixKey := ""
+	for i, v := range cacheNames {
+		if len(v) > 0 {
+			if i == 0 {
+				prefixKey = v
+			} else {
+				prefixKey = fmt.Sprintf("%v:%v", prefixKey, v)
+			}
+		}
+	}
+	return cacheScope{
+		ginCtx:            c,
+		isUseMultiTenancy: useMultiTenancy,
+		prefixKey:         prefixKey,
+	}
+}
+
+// cacheString 值转为字符串，规则与写入 Redis 时一致
+func cacheString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 64), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case encoding.BinaryMarshaler:
+		b, err := v.MarshalBinary()
+		return string(b), err
+	default:
+		return "", fmt.Errorf("不支持的缓存值类型 %T，可使用json序列化后写入", value)
+	}
+}
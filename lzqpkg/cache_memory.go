@@ -0,0 +1,252 @@
+package lzqpkg
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/11/26
+ * @Version 1.0.0
+ */
+
+import (
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// MemoryStore 进程内的缓存存储，超过容量时淘汰最久未使用的key，过期的key在读取时删除
+type MemoryStore struct {
+	mu        sync.Mutex
+	capacity  int
+	ll        *list.List
+	items     map[string]*list.Element
+	version   uint64            // 每次写入、删除时加1
+	clearedAt uint64            // 最近一次 clear 时的 version
+	changed   map[string]uint64 // 最近 memoryChangeWindow 内写入、删除过的key及其 version，fill 据此判断读取期间该key是否有变化
+	changes   []memoryChange    // changed 中的记录按时间排列，用于删除超过 memoryChangeWindow 的记录
+	prefixes  []memoryChange    // 最近 memoryChangeWindow 内按前缀删除的记录，key 为前缀
+}
+
+type memoryChange struct {
+	key     string
+	version uint64
+	at      time.Time
+}
+
+// memoryChangeWindow 保留key变化记录的时间，开始读取超过该时间的值不再通过 fill 写入
+const memoryChangeWindow = 10 * time.Second
+
+// fillToken 从其他存储读取值之前的版本
+type fillToken struct {
+	version uint64
+	at      time.Time
+}
+
+type memoryEntry struct {
+	key       string
+	value     string
+	expiresAt time.Time
+}
+
+// NewMemoryStore capacity 为最多保存的key数量
+func NewMemoryStore(capacity int) *MemoryStore {
+	if capacity <= 0 {
+		capacity = 10000
+	}
+	return &MemoryStore{capacity: capacity, ll: list.New(), items: make(map[string]*list.Element), changed: make(map[string]uint64)}
+}
+
+func (s *MemoryStore) get(nKey string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, isExist := s.items[nKey]
+	if !isExist {
+		return "", false
+	}
+	entry := e.Value.(*memoryEntry)
+	if time.Now().After(entry.expiresAt) {
+		s.removeElement(e)
+		return "", false
+	}
+	s.ll.MoveToFront(e)
+	return entry.value, true
+}
+
+func (s *MemoryStore) set(nKey string, value string, expiration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.markChanged(nKey)
+	s.put(nKey, value, expiration)
+}
+
+// fillToken 从其他存储读取值之前调用，读取后用 fill 写入
+func (s *MemoryStore) fillToken() fillToken {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fillToken{version: s.version, at: time.Now()}
+}
+
+// fill 写入从其他存储读取的值；读取期间该key有写入、删除（包括失效通知）或 clear 时读到的值可能已过时，不写入
+func (s *MemoryStore) fill(nKey string, value string, expiration time.Duration, token fillToken) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.pruneChanges(now)
+	// 超过 memoryChangeWindow 的变化记录已删除，无法判断
+	if now.Sub(token.at) >= memoryChangeWindow || s.clearedAt > token.version || s.changed[nKey] > token.version {
+		return false
+	}
+	for _, c := range s.prefixes {
+		if c.version > token.version && strings.HasPrefix(nKey, c.key) {
+			return false
+		}
+	}
+	s.put(nKey, value, expiration)
+	return true
+}
+
+// markChanged 记录key的变化，调用方需持有锁
+func (s *MemoryStore) markChanged(nKey string) {
+	s.version++
+	now := time.Now()
+	s.pruneChanges(now)
+	s.changed[nKey] = s.version
+	s.changes = append(s.changes, memoryChange{key: nKey, version: s.version, at: now})
+}
+
+// pruneChanges 删除超过 memoryChangeWindow 的变化记录，调用方需持有锁
+func (s *MemoryStore) pruneChanges(now time.Time) {
+	i := 0
+	for ; i < len(s.changes) && now.Sub(s.changes[i].at) >= memoryChangeWindow; i++ {
+		if c := s.changes[i]; s.changed[c.key] == c.version {
+			delete(s.changed, c.key)
+		}
+	}
+	s.changes = s.changes[i:]
+	for len(s.prefixes) > 0 && now.Sub(s.prefixes[0].at) >= memoryChangeWindow {
+		s.prefixes = s.prefixes[1:]
+	}
+}
+
+func (s *MemoryStore) put(nKey string, value string, expiration time.Duration) {
+	expiresAt := time.Now().Add(expiration)
+	if e, isExist := s.items[nKey]; isExist {
+		entry := e.Value.(*memoryEntry)
+		entry.value, entry.expiresAt = value, expiresAt
+		s.ll.MoveToFront(e)
+		return
+	}
+	s.items[nKey] = s.ll.PushFront(&memoryEntry{key: nKey, value: value, expiresAt: expiresAt})
+	for s.ll.Len() > s.capacity {
+		s.removeElement(s.ll.Back())
+	}
+}
+
+func (s *MemoryStore) delete(nKeys ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, nKey := range nKeys {
+		s.markChanged(nKey)
+		if e, isExist := s.items[nKey]; isExist {
+			s.removeElement(e)
+		}
+	}
+}
+
+// deletePrefix 删除以任一 prefix 开头的key
+func (s *MemoryStore) deletePrefix(prefixes ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version++
+	now := time.Now()
+	s.pruneChanges(now)
+	for _, prefix := range prefixes {
+		s.prefixes = append(s.prefixes, memoryChange{key: prefix, version: s.version, at: now})
+	}
+	for nKey, e := range s.items {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(nKey, prefix) {
+				s.removeElement(e)
+				break
+			}
+		}
+	}
+}
+
+// clear 删除全部key
+func (s *MemoryStore) clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version++
+	s.clearedAt = s.version
+	s.changed, s.changes, s.prefixes = make(map[string]uint64), nil, nil
+	s.ll.Init()
+	s.items = make(map[string]*list.Element)
+}
+
+func (s *MemoryStore) removeElement(e *list.Element) {
+	s.ll.Remove(e)
+	delete(s.items, e.Value.(*memoryEntry).key)
+}
+
+// Len 当前保存的key数量，包括已过期未删除的
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ll.Len()
+}
+
+// MemoryCache 进程内缓存，用于测试及单机部署，key 规则同 RedisHelper
+type MemoryCache struct {
+	cacheScope
+	store *MemoryStore
+}
+
+// NewMemoryCache store 由多个请求共享，参数同 RedisUtil.NewRedis
+func NewMemoryCache(store *MemoryStore, c *gin.Context, useMultiTenancy bool, cacheNames ...string) *MemoryCache {
+	return &MemoryCache{cacheScope: newCacheScope(c, useMultiTenancy, cacheNames...), store: store}
+}
+
+func (m *MemoryCache) GetCtx(c context.Context, key string) (string, error) {
+	nKey, err := m.buildKey(key)
+	if err != nil {
+		return "", err
+	}
+	if value, isExist := m.store.get(nKey); isExist {
+		return value, nil
+	}
+	return "", ErrCacheMiss
+}
+
+func (m *MemoryCache) SetCtx(c context.Context, key string, value interface{}, expiration time.Duration) error {
+	nKey, err := m.buildKey(key)
+	if err != nil {
+		return err
+	}
+	str, err := cacheString(value)
+	if err != nil {
+		return err
+	}
+	m.store.set(nKey, str, GetDefaultExpiresAt(expiration))
+	return nil
+}
+
+func (m *MemoryCache) DeleteCtx(c context.Context, key string) error {
+	nKey, err := m.buildKey(key)
+	if err != nil {
+		return err
+	}
+	m.store.delete(nKey)
+	return nil
+}
+
+func (m *MemoryCache) SSetCtx(c context.Context, key string, value interface{}, expiration time.Duration) error {
+	json, err := jsoniter.MarshalToString(value)
+	if err != nil {
+		return err
+	}
+	return m.SetCtx(c, key, json, expiration)
+}
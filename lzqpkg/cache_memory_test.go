@@ -0,0 +1,214 @@
+package lzqpkg
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/11/26
+ * @Version 1.0.0
+ */
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreLRU(t *testing.T) {
+	s := NewMemoryStore(2)
+	s.set("a", "1", time.Minute)
+	s.set("b", "2", time.Minute)
+	// 读取 a 后 b 成为最久未使用的key
+	if _, isExist := s.get("a"); !isExist {
+		t.Fatal("a: want hit")
+	}
+	s.set("c", "3", time.Minute)
+	if _, isExist := s.get("b"); isExist {
+		t.Error("b: want evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, isExist := s.get(key); !isExist {
+			t.Errorf("%v: want hit", key)
+		}
+	}
+	// 覆盖已有的key不淘汰其他key
+	s.set("a", "4", time.Minute)
+	if v, _ := s.get("a"); v != "4" || s.Len() != 2 {
+		t.Errorf("a: got %v, len %v, want 4, 2", v, s.Len())
+	}
+}
+
+func TestMemoryStoreTTL(t *testing.T) {
+	s := NewMemoryStore(10)
+	s.set("a", "1", 20*time.Millisecond)
+	s.set("b", "2", time.Minute)
+	if _, isExist := s.get("a"); !isExist {
+		t.Fatal("a: want hit before expiration")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, isExist := s.get("a"); isExist {
+		t.Error("a: want miss after expiration")
+	}
+	if s.Len() != 1 {
+		t.Errorf("len: got %v, want 1 (expired key removed on read)", s.Len())
+	}
+	if _, isExist := s.get("b"); !isExist {
+		t.Error("b: want hit")
+	}
+}
+
+func TestMemoryStoreFill(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(s *MemoryStore)
+		filled bool
+	}{
+		{"no change", func(s *MemoryStore) {}, true},
+		{"other key set", func(s *MemoryStore) { s.set("b", "x", time.Minute) }, true},
+		{"other key deleted", func(s *MemoryStore) { s.delete("b") }, true},
+		{"same key set", func(s *MemoryStore) { s.set("a", "new", time.Minute) }, false},
+		{"same key deleted", func(s *MemoryStore) { s.delete("a") }, false},
+		{"same key in batch delete", func(s *MemoryStore) { s.delete("b", "a") }, false},
+		{"cleared", func(s *MemoryStore) { s.clear() }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMemoryStore(10)
+			token := s.fillToken()
+			tt.change(s)
+			if filled := s.fill("a", "old", time.Minute, token); filled != tt.filled {
+				t.Errorf("fill: got %v, want %v", filled, tt.filled)
+			}
+		})
+	}
+
+	// 读取开始前的变化不影响写入
+	s := NewMemoryStore(10)
+	s.delete("a")
+	if !s.fill("a", "v", time.Minute, s.fillToken()) {
+		t.Error("change before token: want filled")
+	}
+
+	// 变化记录超过 memoryChangeWindow 后删除，更早开始的读取不再写入
+	s = NewMemoryStore(10)
+	token := s.fillToken()
+	token.at = token.at.Add(-memoryChangeWindow)
+	if s.fill("a", "v", time.Minute, token) {
+		t.Error("token older than window: want rejected")
+	}
+	s.set("b", "x", time.Minute)
+	s.changes[0].at = s.changes[0].at.Add(-memoryChangeWindow)
+	s.pruneChanges(time.Now())
+	if len(s.changed) != 0 || len(s.changes) != 0 {
+		t.Errorf("prune: got %v, %v, want empty", s.changed, s.changes)
+	}
+}
+
+func TestMemoryStoreDeletePrefix(t *testing.T) {
+	s := NewMemoryStore(10)
+	for _, nKey := range []string{"c:user:1", "c:user:vip:2", "c:userx:3", "{c:user}:4", "{c:user:vip}:5", "{c:userx}:6"} {
+		s.set(nKey, "v", time.Minute)
+	}
+	token := s.fillToken()
+	s.deletePrefix("c:user:", "{c:user}", "{c:user:")
+	for nKey, want := range map[string]bool{
+		"c:user:1": false, "c:user:vip:2": false, "c:userx:3": true,
+		"{c:user}:4": false, "{c:user:vip}:5": false, "{c:userx}:6": true,
+	} {
+		if _, isExist := s.get(nKey); isExist != want {
+			t.Errorf("%v: got %v, want %v", nKey, isExist, want)
+		}
+	}
+	// 删除前开始的读取不写入相同前缀的key
+	if s.fill("c:user:7", "old", time.Minute, token) {
+		t.Error("fill under deleted prefix: want rejected")
+	}
+	if !s.fill("c:userx:7", "v", time.Minute, token) {
+		t.Error("fill under other prefix: want filled")
+	}
+	if !s.fill("c:user:7", "v", time.Minute, s.fillToken()) {
+		t.Error("fill after delete: want filled")
+	}
+}
+
+func TestMemoryStoreConcurrent(t *testing.T) {
+	s := NewMemoryStore(50)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				key := fmt.Sprint(j % 100)
+				switch (i + j) % 4 {
+				case 0:
+					s.set(key, "v", time.Minute)
+				case 1:
+					s.get(key)
+				case 2:
+					s.fill(key, "v", time.Minute, s.fillToken())
+				default:
+					s.delete(key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if s.Len() > 50 {
+		t.Errorf("len: got %v, want <= 50", s.Len())
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	store := NewMemoryStore(10)
+	c := context.Background()
+	// 不需要 Redis 配置及 gin.Context
+	users := NewMemoryCache(store, nil, false, "user")
+	roles := NewMemoryCache(store, nil, false, "role")
+
+	if _, err := users.GetCtx(c, "1"); !errors.Is(err, ErrCacheMiss) {
+		t.Fatalf("miss: got %v, want ErrCacheMiss", err)
+	}
+	if err := users.SetCtx(c, "1", "tom", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := users.GetCtx(c, "1"); err != nil || v != "tom" {
+		t.Errorf("get: got %v, %v, want tom", v, err)
+	}
+	// 不同缓存名称的key互不影响
+	if _, err := roles.GetCtx(c, "1"); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("other cache name: got %v, want ErrCacheMiss", err)
+	}
+	if err := users.DeleteCtx(c, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := users.GetCtx(c, "1"); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("after delete: got %v, want ErrCacheMiss", err)
+	}
+
+	type user struct {
+		Id   int64
+		Name string
+	}
+	if err := users.SSetCtx(c, "2", user{Id: 2, Name: "amy"}, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if v, found, err := SGetCtx[user](c, users, "2"); !found || err != nil || v.Name != "amy" {
+		t.Errorf("SGetCtx: got %+v, %v, %v", v, found, err)
+	}
+
+	calls := 0
+	loader := func() (user, error) {
+		calls++
+		return user{Id: 3, Name: "bob"}, nil
+	}
+	for i := 0; i < 2; i++ {
+		if v, err := GetOrLoadCtx(c, users, "3", time.Minute, loader); err != nil || v.Name != "bob" {
+			t.Errorf("GetOrLoadCtx: got %+v, %v", v, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("loader calls: got %v, want 1", calls)
+	}
+}
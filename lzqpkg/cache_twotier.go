@@ -0,0 +1,209 @@
+package lzqpkg
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/11/26
+ * @Version 1.0.0
+ */
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// 两级缓存：一级为进程内的 MemoryStore，二级为 Redis。
+// 写入、删除时先写 Redis，再通过 Redis 发布订阅通知其他实例删除一级缓存；
+// 一级缓存的过期时间较短；订阅中断后重新订阅并清空一级缓存。
+
+// invalidateChannel 一级缓存失效通知的频道，消息为 实例ID|key；
+// 加上 :prefix 后缀的频道为按前缀失效（InvalidatePrefix），消息为 实例ID|前缀，实例ID为空时所有实例都处理
+const invalidateChannel = "lzq:cache:invalidate"
+
+// TwoTierStore 两级缓存的存储，每个进程创建一个并由多个请求共享，不再使用时调用 Close
+type TwoTierStore struct {
+	memory       *MemoryStore
+	l1Expiration time.Duration
+	instanceId   string
+	closeOnce    sync.Once
+	cancel       context.CancelFunc
+}
+
+// NewTwoTierStore l1Expiration 为一级缓存的最长过期时间，<=0 时为1分钟；创建时开始订阅失效通知
+func NewTwoTierStore(memory *MemoryStore, l1Expiration time.Duration) *TwoTierStore {
+	if l1Expiration <= 0 {
+		l1Expiration = time.Minute
+	}
+	subCtx, cancel := context.WithCancel(context.Background())
+	s := &TwoTierStore{memory: memory, l1Expiration: l1Expiration, instanceId: UuidCreate(), cancel: cancel}
+	go s.subscribe(subCtx)
+	return s
+}
+
+// invalidateChannels 按key失效及按前缀失效的频道
+func invalidateChannels() (string, string) {
+	channel := invalidateChannel
+	if opts, _ := getRedisConfig(); len(opts.RedisPoolName) > 0 {
+		channel = opts.RedisPoolName + ":" + invalidateChannel
+	}
+	return channel, channel + ":prefix"
+}
+
+// subscribeRetryInterval 订阅中断后重新订阅的间隔，也是检查Redis客户端是否被替换（InitRedis、CloseRedis）的间隔
+const subscribeRetryInterval = time.Second
+
+// subscribe 订阅失效通知，订阅中断或Redis客户端被替换时重新订阅，直到 Close
+func (s *TwoTierStore) subscribe(c context.Context) {
+	for {
+		err := s.receive(c, getRedisClient())
+		if c.Err() != nil {
+			return
+		}
+		LogError("缓存失效通知订阅中断，重新订阅", err)
+		// 中断期间可能漏掉了通知，清空一级缓存
+		s.memory.clear()
+		select {
+		case <-c.Done():
+			return
+		case <-time.After(subscribeRetryInterval):
+		}
+	}
+}
+
+// receive 收到其他实例的通知时删除一级缓存，订阅失败、中断或客户端被替换时返回
+func (s *TwoTierStore) receive(c context.Context, client redis.UniversalClient) error {
+	keyChannel, prefixChannel := invalidateChannels()
+	pubsub := client.Subscribe(c, keyChannel, prefixChannel)
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(c); err != nil {
+		return err
+	}
+	ch := pubsub.Channel()
+	ticker := time.NewTicker(subscribeRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Done():
+			return c.Err()
+		case <-ticker.C:
+			if getRedisClient() != client {
+				return errors.New("Redis客户端已替换")
+			}
+		case msg, isOpen := <-ch:
+			if !isOpen {
+				return errors.New("订阅已关闭")
+			}
+			parts := strings.SplitN(msg.Payload, "|", 2)
+			if len(parts) != 2 || parts[0] == s.instanceId {
+				continue
+			}
+			if msg.Channel == prefixChannel {
+				s.memory.deletePrefix(parts[1])
+			} else {
+				s.memory.delete(parts[1])
+			}
+		}
+	}
+}
+
+// publish 通知其他实例删除一级缓存
+func (s *TwoTierStore) publish(c context.Context, nKey string) {
+	keyChannel, _ := invalidateChannels()
+	if err := getRedisClient().Publish(c, keyChannel, s.instanceId+"|"+nKey).Err(); err != nil {
+		LogError("发送缓存失效通知失败", err)
+	}
+}
+
+// Close 停止订阅失效通知
+func (s *TwoTierStore) Close() {
+	s.closeOnce.Do(s.cancel)
+}
+
+// TwoTierCache 两级缓存，key 规则同 RedisHelper
+type TwoTierCache struct {
+	cacheScope
+	store *TwoTierStore
+	redis *RedisHelper
+}
+
+// NewTwoTierCache store 由多个请求共享，参数同 RedisUtil.NewRedis
+func NewTwoTierCache(store *TwoTierStore, c *gin.Context, useMultiTenancy bool, cacheNames ...string) *TwoTierCache {
+	scope := newCacheScope(c, useMultiTenancy, cacheNames...)
+	return &TwoTierCache{cacheScope: scope, store: store, redis: &RedisHelper{cacheScope: scope}}
+}
+
+func (t *TwoTierCache) GetCtx(c context.Context, key string) (string, error) {
+	nKey, err := t.buildKey(key)
+	if err != nil {
+		return "", err
+	}
+	if value, isExist := t.store.memory.get(nKey); isExist {
+		return value, nil
+	}
+	token := t.store.memory.fillToken()
+	value, err := t.redis.GetCtx(c, key)
+	if err != nil {
+		return "", err
+	}
+	t.store.memory.fill(nKey, value, t.l1Expiration(c, nKey), token)
+	return value, nil
+}
+
+// l1Expiration 一级缓存的过期时间，不超过 Redis 中剩余的过期时间
+func (t *TwoTierCache) l1Expiration(c context.Context, nKey string) time.Duration {
+	expiration := t.store.l1Expiration
+	if ttl, err := getRedisClient().PTTL(c, nKey).Result(); err == nil && ttl > 0 && ttl < expiration {
+		expiration = ttl
+	}
+	return expiration
+}
+
+func (t *TwoTierCache) SetCtx(c context.Context, key string, value interface{}, expiration time.Duration) error {
+	nKey, err := t.buildKey(key)
+	if err != nil {
+		return err
+	}
+	str, err := cacheString(value)
+	if err != nil {
+		return err
+	}
+	expiration = GetDefaultExpiresAt(expiration)
+	if err := t.redis.SetCtx(c, key, str, expiration); err != nil {
+		return err
+	}
+	if expiration > t.store.l1Expiration {
+		expiration = t.store.l1Expiration
+	}
+	t.store.memory.set(nKey, str, expiration)
+	t.store.publish(c, nKey)
+	return nil
+}
+
+func (t *TwoTierCache) DeleteCtx(c context.Context, key string) error {
+	nKey, err := t.buildKey(key)
+	if err != nil {
+		return err
+	}
+	// 删除 Redis 之后再删除一级缓存，删除之前开始的读取不会再写入一级缓存
+	err = t.redis.DeleteCtx(c, key)
+	t.store.memory.delete(nKey)
+	if err != nil {
+		return err
+	}
+	t.store.publish(c, nKey)
+	return nil
+}
+
+func (t *TwoTierCache) SSetCtx(c context.Context, key string, value interface{}, expiration time.Duration) error {
+	json, err := jsoniter.MarshalToString(value)
+	if err != nil {
+		return err
+	}
+	return t.SetCtx(c, key, json, expiration)
+}
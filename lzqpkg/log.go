@@ -33,7 +33,9 @@ var LzgLogger = &LogConfig{}
 var lzqLog = logrus.New()
 
 func NewLzqLog() {
-	config.LzqConfig.Sub("log").Unmarshal(&LzgLogger)
+	if sub := config.LzqConfig.Sub("log"); sub != nil {
+		sub.Unmarshal(&LzgLogger)
+	}
 	// 为当前logrus实例设置消息输出格式为json格式
 	lzqLog.Formatter = &logrus.JSONFormatter{}
 	// 设置日志级别为warn以上
@@ -10,75 +10,84 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	token "github.com/zhaohuawu/lzq-framework/auth"
-	"github.com/zhaohuawu/lzq-framework/config"
 
-	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
 	jsoniter "github.com/json-iterator/go"
 )
 
-// RedisClient Redis缓存客户端单例
-var redisClient *redis.Client
-var ctx = context.Background()
-
-type RedisConfig struct {
-	RedisHost     string `mapstructure:"RedisHost"`
-	RedisPwd      string `mapstructure:"RedisPwd"`
-	RedisDB       int    `mapstructure:"RedisDB"`
-	RedisPoolName string `mapstructure:"RedisPoolName"`
+type RedisHelper struct {
+	cacheScope
 }
 
-var rconfig = &RedisConfig{}
-var useMultiTenancy bool
+// ErrEmptyKey 缓存key为空
+var ErrEmptyKey = errors.New("key不能为空")
 
-func init() {
-	config.LzqConfig.Sub("redis").Unmarshal(&rconfig)
-	useMultiTenancy = config.LzqConfig.GetBool("server.UseMultiTenancy")
-	client := redis.NewClient(&redis.Options{
-		Addr:     rconfig.RedisHost,
-		Password: rconfig.RedisPwd,
-		DB:       rconfig.RedisDB,
-	})
-	if _, err := client.Ping(ctx).Result(); err != nil {
-		LogError("", err)
+func (r *cacheScope) normalizeKey(key string) string {
+	nKey, err := r.buildKey(key)
+	if err != nil {
+		LogError(err.Error(), nil)
 		panic(err)
 	}
-
-	redisClient = client
-}
-
-type RedisHelper struct {
-	ginCtx            *gin.Context
-	isUseMultiTenancy bool
-	prefixKey         string
+	return nKey
 }
 
-func (r *RedisHelper) normalizeKey(key string) string {
+// buildKey 拼接缓存池、租户、缓存名称，key 为空时返回 ErrEmptyKey
+// 集群模式下有缓存名称时，租户及缓存名称作为 hash tag（如 pool:{t:1:user}:key），
+// 同一个缓存名称的key在同一个slot，MGET 等多key命令可以直接执行；代价是单个缓存名称的数据只在一个分片上，
+// 数据量很大的缓存应按业务拆分缓存名称。没有缓存名称的key不加 hash tag，分散到各分片，多key命令改为逐个执行
+func (r *cacheScope) buildKey(key string) (string, error) {
 	if len(key) == 0 {
-		LogError("key不能为空", nil)
-		panic(errors.New("key不能为空"))
+		return "", ErrEmptyKey
 	}
-	nKey := key
-	// 拼接缓存名称
-	if r != nil && len(r.prefixKey) > 0 {
-		nKey = fmt.Sprintf("%v:%v", r.prefixKey, nKey)
+	return fmt.Sprintf("%v:%v", r.keyPrefix(r.prefixKey), key), nil
+}
+
+// keyPrefix 缓存池、租户及缓存名称组成的key前缀
+func (r *cacheScope) keyPrefix(prefixKey string) string {
+	pool, scope, isCluster := r.keyScope(prefixKey)
+	if isCluster && len(prefixKey) > 0 {
+		scope = fmt.Sprintf("{%v}", scope)
 	}
+	return pool + scope
+}
+
+// keyScope 返回缓存池前缀（如 pool:）、租户及缓存名称（如 t:1:user）和是否为集群模式
+func (r *cacheScope) keyScope(prefixKey string) (string, string, bool) {
 	//fmt.Println("Redis:GlobalTokenClaims",token.GlobalTokenClaims)
+	opts, multiTenancy := getRedisConfig()
 	// 租户ID
-	tenantId := token.GetCurrentTenantId(r.ginCtx)
-	if r != nil && r.isUseMultiTenancy && useMultiTenancy && len(tenantId) > 0 {
-		nKey = fmt.Sprintf("t:%v:%v", tenantId, nKey)
-	} else {
-		nKey = fmt.Sprintf("c:%v", nKey)
+	scope := "c"
+	if r != nil && r.isUseMultiTenancy && multiTenancy && r.ginCtx != nil {
+		if tenantId := token.GetCurrentTenantId(r.ginCtx); len(tenantId) > 0 {
+			scope = fmt.Sprintf("t:%v", tenantId)
+		}
+	}
+	// 拼接缓存名称
+	if len(prefixKey) > 0 {
+		scope = fmt.Sprintf("%v:%v", scope, prefixKey)
 	}
 	// 缓存池
-	if len(rconfig.RedisPoolName) > 0 {
-		nKey = fmt.Sprintf("%v:%v", rconfig.RedisPoolName, nKey)
+	pool := ""
+	if len(opts.RedisPoolName) > 0 {
+		pool = opts.RedisPoolName + ":"
 	}
-	return nKey
+	return pool, scope, opts.IsCluster()
+}
+
+func (r *cacheScope) buildKeys(keys []string) ([]string, error) {
+	keyNs := make([]string, 0, len(keys))
+	for _, v := range keys {
+		nKey, err := r.buildKey(v)
+		if err != nil {
+			return nil, err
+		}
+		keyNs = append(keyNs, nKey)
+	}
+	return keyNs, nil
 }
 
 func GetDefaultExpiresAt(expiration time.Duration) time.Duration {
@@ -89,87 +98,302 @@ func GetDefaultExpiresAt(expiration time.Duration) time.Duration {
 	}
 }
 
+// GetCtx 读取字符串，不存在时返回 ErrCacheMiss
+func (r *RedisHelper) GetCtx(c context.Context, key string) (string, error) {
+	nKey, err := r.buildKey(key)
+	if err != nil {
+		return "", err
+	}
+	val, err := getRedisClient().Get(c, nKey).Result()
+	if err == redis.Nil {
+		return "", ErrCacheMiss
+	}
+	return val, err
+}
+
+// SetCtx 写入缓存，expiration<=0 时使用默认过期时间
+func (r *RedisHelper) SetCtx(c context.Context, key string, value interface{}, expiration time.Duration) error {
+	nKey, err := r.buildKey(key)
+	if err != nil {
+		return err
+	}
+	return getRedisClient().Set(c, nKey, value, GetDefaultExpiresAt(expiration)).Err()
+}
+
+// SSetCtx 值使用json序列化后写入，配合 SGet 使用
+func (r *RedisHelper) SSetCtx(c context.Context, key string, value interface{}, expiration time.Duration) error {
+	json, err := jsoniter.MarshalToString(value)
+	if err != nil {
+		return err
+	}
+	return r.SetCtx(c, key, json, expiration)
+}
+
+func (r *RedisHelper) DeleteCtx(c context.Context, key string) error {
+	nKey, err := r.buildKey(key)
+	if err != nil {
+		return err
+	}
+	return getRedisClient().Del(c, nKey).Err()
+}
+
+// Deprecated: KEYS 会阻塞 Redis，且 pattern 未拼接缓存池、租户、缓存名称，使用 Scan
+func (r *RedisHelper) KeysCtx(c context.Context, pattern string) ([]string, error) {
+	client := getRedisClient()
+	cluster, isCluster := client.(*redis.ClusterClient)
+	if !isCluster {
+		return client.Keys(c, pattern).Result()
+	}
+	// 集群模式下合并各主节点的结果
+	var mu sync.Mutex
+	keys := make([]string, 0)
+	err := cluster.ForEachMaster(c, func(c context.Context, node *redis.Client) error {
+		val, err := node.Keys(c, pattern).Result()
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		keys = append(keys, val...)
+		mu.Unlock()
+		return nil
+	})
+	return keys, err
+}
+
+// MultiGetCtx 批量读取，返回值与 keys 一一对应，不存在的为 nil
+func (r *RedisHelper) MultiGetCtx(c context.Context, keys []string) ([]interface{}, error) {
+	keyNs, err := r.buildKeys(keys)
+	if err != nil {
+		return nil, err
+	}
+	if len(keyNs) == 0 {
+		return []interface{}{}, nil
+	}
+	return r.mget(c, keyNs)
+}
+
+func (r *RedisHelper) MultiDeleteCtx(c context.Context, keys []string) error {
+	keyNs, err := r.buildKeys(keys)
+	if err != nil || len(keyNs) == 0 {
+		return err
+	}
+	if r.sameSlot() {
+		return getRedisClient().Del(c, keyNs...).Err()
+	}
+	_, err = getRedisClient().Pipelined(c, func(pipe redis.Pipeliner) error {
+		for _, nKey := range keyNs {
+			pipe.Del(c, nKey)
+		}
+		return nil
+	})
+	return err
+}
+
+// sameSlot 多key命令的key是否在同一个slot：非集群模式，或有缓存名称（作为 hash tag）
+func (r *cacheScope) sameSlot() bool {
+	opts, _ := getRedisConfig()
+	return !opts.IsCluster() || len(r.prefixKey) > 0
+}
+
+// mget 不在同一个slot时逐个读取，由 pipeline 合并发送，返回值同 MGET，不存在的为 nil
+func (r *cacheScope) mget(c context.Context, keyNs []string) ([]interface{}, error) {
+	if r.sameSlot() {
+		return getRedisClient().MGet(c, keyNs...).Result()
+	}
+	cmds, _ := getRedisClient().Pipelined(c, func(pipe redis.Pipeliner) error {
+		for _, nKey := range keyNs {
+			pipe.Get(c, nKey)
+		}
+		return nil
+	})
+	values := make([]interface{}, len(cmds))
+	for i, cmd := range cmds {
+		val, err := cmd.(*redis.StringCmd).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[i] = val
+	}
+	return values, nil
+}
+
+// HSetCtx 写入hash的字段，hash 没有过期时间时设置过期时间
+func (r *RedisHelper) HSetCtx(c context.Context, key, field string, value interface{}, duration time.Duration) error {
+	hkey, err := r.buildKey(key)
+	if err != nil {
+		return err
+	}
+	if err := getRedisClient().HSet(c, hkey, field, value).Err(); err != nil {
+		return err
+	}
+	ttl, err := getRedisClient().TTL(c, hkey).Result()
+	if err != nil {
+		return err
+	}
+	if ttl < 0 {
+		return getRedisClient().Expire(c, hkey, GetDefaultExpiresAt(duration)).Err()
+	}
+	return nil
+}
+
+// HSSetCtx 值使用json序列化后写入hash，配合 HSGet 使用
+func (r *RedisHelper) HSSetCtx(c context.Context, key, field string, value interface{}, duration time.Duration) error {
+	json, err := jsoniter.MarshalToString(value)
+	if err != nil {
+		return err
+	}
+	return r.HSetCtx(c, key, field, json, duration)
+}
+
+// HGetCtx 读取hash的字段，不存在时返回 ErrCacheMiss
+func (r *RedisHelper) HGetCtx(c context.Context, key, field string) (string, error) {
+	hkey, err := r.buildKey(key)
+	if err != nil {
+		return "", err
+	}
+	val, err := getRedisClient().HGet(c, hkey, field).Result()
+	if err == redis.Nil {
+		return "", ErrCacheMiss
+	}
+	return val, err
+}
+
+// HDeleteCtx 删除hash的字段，返回删除的字段数
+func (r *RedisHelper) HDeleteCtx(c context.Context, key string, fields ...string) (int64, error) {
+	hkey, err := r.buildKey(key)
+	if err != nil {
+		return 0, err
+	}
+	return getRedisClient().HDel(c, hkey, fields...).Result()
+}
+
+// HGetAllCtx 读取hash的全部字段，不存在时返回空map
+func (r *RedisHelper) HGetAllCtx(c context.Context, key string) (map[string]string, error) {
+	hkey, err := r.buildKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return getRedisClient().HGetAll(c, hkey).Result()
+}
+
+func (r *RedisHelper) IncrByCtx(c context.Context, key string, increment int64) (int64, error) {
+	nKey, err := r.buildKey(key)
+	if err != nil {
+		return 0, err
+	}
+	return getRedisClient().IncrBy(c, nKey, increment).Result()
+}
+
+// 以下为原有的方法，Redis 出错时 panic 或返回空值，无法区分缓存不存在和 Redis 错误
+
+// Deprecated: 使用 GetCtx
 func (r *RedisHelper) Get(key string) string {
-	val, err := redisClient.Get(ctx, r.normalizeKey(key)).Result()
+	val, err := r.GetCtx(ctx, mustKey(key))
 	if err != nil {
 		return ""
 	}
 	return val
 }
+
+// Deprecated: 使用 SetCtx
 func (r *RedisHelper) Set(key string, value interface{}, expiration time.Duration) {
-	if err := redisClient.Set(ctx, r.normalizeKey(key), value, GetDefaultExpiresAt(expiration)).Err(); err != nil {
+	if err := r.SetCtx(ctx, mustKey(key), value, expiration); err != nil {
 		panic(err)
 	}
 }
+
+// Deprecated: 使用 SSetCtx
 func (r *RedisHelper) SSet(key string, value interface{}, expiration time.Duration) {
 	json, _ := jsoniter.MarshalToString(value)
 	r.Set(key, json, expiration)
 }
+
+// Deprecated: 使用 DeleteCtx
 func (r *RedisHelper) Delete(key string) {
-	redisClient.Del(ctx, r.normalizeKey(key))
+	_ = r.DeleteCtx(ctx, mustKey(key))
 }
+
+// Deprecated: 使用 Scan
 func (r *RedisHelper) Keys(pattern string) []string {
-	val, err := redisClient.Keys(ctx, pattern).Result()
+	val, err := r.KeysCtx(ctx, pattern)
 	if err != nil {
 		return []string{}
 	}
 	return val
 }
+
+// Deprecated: 使用 MultiGetCtx
 func (r *RedisHelper) MultiGet(keys []string) []interface{} {
-	keyNs := make([]string, 0)
-	for _, v := range keys {
-		keyNs = append(keyNs, r.normalizeKey(v))
-	}
-	val, err := redisClient.MGet(ctx, keyNs...).Result()
+	val, err := r.MultiGetCtx(ctx, mustKeys(keys))
 	if err != nil {
 		return []interface{}{}
 	}
 	return val
 }
+
+// Deprecated: 使用 MultiDeleteCtx
 func (r *RedisHelper) MultiDelete(keys []string) {
-	keyNs := make([]string, 0)
-	for _, v := range keys {
-		keyNs = append(keyNs, r.normalizeKey(v))
-	}
-	redisClient.Del(ctx, keyNs...)
+	_ = r.MultiDeleteCtx(ctx, mustKeys(keys))
 }
 
+// Deprecated: 使用 HSetCtx
 func (r *RedisHelper) HSet(key, field string, value interface{}, duration time.Duration) {
-	hkey := r.normalizeKey(key)
-	if err := redisClient.HSet(ctx, hkey, field, value).Err(); err != nil {
+	if err := r.HSetCtx(ctx, mustKey(key), field, value, duration); err != nil {
 		panic(err)
 	}
-	var ttl = redisClient.TTL(ctx, hkey).Val().Seconds()
-	if ttl < 0 {
-		redisClient.Expire(ctx, hkey, GetDefaultExpiresAt(duration))
-	}
 }
+
+// Deprecated: 使用 HGetCtx
 func (r *RedisHelper) HGet(key, field string) interface{} {
-	val, err := redisClient.HGet(ctx, r.normalizeKey(key), field).Result()
+	val, err := r.HGetCtx(ctx, mustKey(key), field)
 	if err != nil {
 		return nil
 	}
 	return val
 }
+
+// Deprecated: 使用 HDeleteCtx
 func (r *RedisHelper) HDelete(key string, fields ...string) interface{} {
-	val, err := redisClient.HDel(ctx, r.normalizeKey(key), fields...).Result()
+	val, err := r.HDeleteCtx(ctx, mustKey(key), fields...)
 	if err != nil {
 		return ""
 	}
 	return val
 }
+
+// Deprecated: 使用 HGetAllCtx
 func (r *RedisHelper) HGetAll(key string) interface{} {
-	val, err := redisClient.HGetAll(ctx, r.normalizeKey(key)).Result()
+	val, err := r.HGetAllCtx(ctx, mustKey(key))
 	if err != nil {
 		return ""
 	}
 	return val
 }
 
+// Deprecated: 使用 IncrByCtx
 func (r *RedisHelper) IncrBy(key string, increment int64) int64 {
-	val, err := redisClient.IncrBy(ctx, r.normalizeKey(key), increment).Result()
+	val, err := r.IncrByCtx(ctx, mustKey(key), increment)
 	if err != nil {
 		panic(err)
 	}
 	return val
 }
+
+// mustKey 原有方法 key 为空时 panic
+func mustKey(key string) string {
+	if len(key) == 0 {
+		LogError(ErrEmptyKey.Error(), nil)
+		panic(ErrEmptyKey)
+	}
+	return key
+}
+
+func mustKeys(keys []string) []string {
+	for _, v := range keys {
+		mustKey(v)
+	}
+	return keys
+}
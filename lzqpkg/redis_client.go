@@ -0,0 +1,213 @@
+package lzqpkg
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/11/27
+ * @Version 1.0.0
+ */
+
+import (
+	"context"
+	"crypto/tls"
+	"sync"
+	"time"
+
+	"github.com/zhaohuawu/lzq-framework/config"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Redis 客户端不在导入包时创建：
+// 启动时可调用 InitRedis 创建并检查连接，未调用时在第一次使用时按配置文件中的 [redis] 创建（不检查连接）。
+// 带 context 的方法（GetCtx 等）以 context 的截止时间为准，其余方法使用 ReadTimeout、WriteTimeout。
+// 部署方式：配置 ClusterAddrs 时为集群，配置 MasterName 时为哨兵，否则为单机 RedisHost。
+
+// RedisConfig Redis配置，时间格式如 5s、500ms，未配置的项使用 go-redis 的默认值
+type RedisConfig struct {
+	RedisHost     string `mapstructure:"RedisHost"`
+	RedisPwd      string `mapstructure:"RedisPwd"`
+	RedisDB       int    `mapstructure:"RedisDB"`
+	RedisPoolName string `mapstructure:"RedisPoolName"`
+
+	MasterName      string   `mapstructure:"MasterName"`      //哨兵模式的主节点名称
+	SentinelAddrs   []string `mapstructure:"SentinelAddrs"`   //哨兵地址，多个用逗号分隔
+	SentinelPwd     string   `mapstructure:"SentinelPwd"`     //哨兵密码，与 RedisPwd 不同时配置
+	ClusterAddrs    []string `mapstructure:"ClusterAddrs"`    //集群节点地址，多个用逗号分隔
+	ReadFromReplica bool     `mapstructure:"ReadFromReplica"` //只读命令发送到从节点，从节点数据可能有延迟
+
+	PoolSize     int           `mapstructure:"PoolSize"`     //连接池大小，默认为 CPU 数*10
+	MinIdleConns int           `mapstructure:"MinIdleConns"` //最少空闲连接数
+	DialTimeout  time.Duration `mapstructure:"DialTimeout"`  //建立连接超时，默认5s
+	ReadTimeout  time.Duration `mapstructure:"ReadTimeout"`  //读超时，默认3s
+	WriteTimeout time.Duration `mapstructure:"WriteTimeout"` //写超时，默认同 ReadTimeout
+	PoolTimeout  time.Duration `mapstructure:"PoolTimeout"`  //等待空闲连接超时，默认 ReadTimeout+1s
+
+	MaxRetries      int           `mapstructure:"MaxRetries"`      //失败重试次数，默认3次，-1 不重试
+	MinRetryBackoff time.Duration `mapstructure:"MinRetryBackoff"` //重试最小间隔，默认8ms
+	MaxRetryBackoff time.Duration `mapstructure:"MaxRetryBackoff"` //重试最大间隔，默认512ms
+
+	UseTLS        bool   `mapstructure:"UseTLS"`
+	TLSServerName string `mapstructure:"TLSServerName"` //证书中的服务器名称，默认取 RedisHost 中的主机名
+	TLSSkipVerify bool   `mapstructure:"TLSSkipVerify"` //不校验服务器证书，仅用于测试环境
+}
+
+// IsCluster 是否为集群模式
+func (opts *RedisConfig) IsCluster() bool {
+	return len(opts.ClusterAddrs) > 0
+}
+
+var (
+	redisMu         sync.RWMutex
+	redisClient     redis.UniversalClient
+	rconfig         = &RedisConfig{}
+	useMultiTenancy bool
+	configLoaded    bool
+)
+
+// 不带 context 的方法使用的 context
+var ctx = context.Background()
+
+// LoadRedisConfig 读取配置文件中的 [redis]
+func LoadRedisConfig() *RedisConfig {
+	opts := &RedisConfig{}
+	if sub := config.LzqConfig.Sub("redis"); sub != nil {
+		if err := sub.Unmarshal(opts); err != nil {
+			LogError("读取Redis配置失败", err)
+		}
+	}
+	return opts
+}
+
+// NewRedisClient 按配置创建客户端，不检查连接，用于 Redlock 等需要多个独立实例的场景
+func NewRedisClient(opts *RedisConfig) redis.UniversalClient {
+	options := &redis.UniversalOptions{
+		Addrs:            []string{opts.RedisHost},
+		Password:         opts.RedisPwd,
+		DB:               opts.RedisDB,
+		MasterName:       opts.MasterName,
+		SentinelPassword: opts.SentinelPwd,
+		PoolSize:         opts.PoolSize,
+		MinIdleConns:     opts.MinIdleConns,
+		DialTimeout:      opts.DialTimeout,
+		ReadTimeout:      opts.ReadTimeout,
+		WriteTimeout:     opts.WriteTimeout,
+		PoolTimeout:      opts.PoolTimeout,
+		MaxRetries:       opts.MaxRetries,
+		MinRetryBackoff:  opts.MinRetryBackoff,
+		MaxRetryBackoff:  opts.MaxRetryBackoff,
+	}
+	if opts.UseTLS {
+		options.TLSConfig = &tls.Config{
+			ServerName:         opts.TLSServerName,
+			InsecureSkipVerify: opts.TLSSkipVerify,
+			MinVersion:         tls.VersionTLS12,
+		}
+	}
+
+	switch {
+	case opts.IsCluster():
+		options.Addrs = opts.ClusterAddrs
+		options.ReadOnly = opts.ReadFromReplica
+		return redis.NewClusterClient(options.Cluster())
+	case len(opts.MasterName) > 0:
+		options.Addrs = opts.SentinelAddrs
+		if opts.ReadFromReplica {
+			// 读命令随机发送到主节点或从节点
+			failover := options.Failover()
+			failover.RouteRandomly = true
+			return redis.NewFailoverClusterClient(failover)
+		}
+		return redis.NewFailoverClient(options.Failover())
+	default:
+		return redis.NewClient(options.Simple())
+	}
+}
+
+// InitRedis 创建Redis客户端并检查连接，opts 为空时读取配置文件，连接失败时返回错误且不替换已有的客户端
+func InitRedis(opts *RedisConfig) error {
+	if opts == nil {
+		opts = LoadRedisConfig()
+	}
+	client := NewRedisClient(opts)
+	timeout := opts.DialTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	pingCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := client.Ping(pingCtx).Err(); err != nil {
+		_ = client.Close()
+		return err
+	}
+
+	redisMu.Lock()
+	old := redisClient
+	redisClient, rconfig = client, opts
+	useMultiTenancy = config.LzqConfig.GetBool("server.UseMultiTenancy")
+	configLoaded = true
+	redisMu.Unlock()
+	if old != nil {
+		_ = old.Close()
+	}
+	return nil
+}
+
+// getRedisClient 未调用 InitRedis 时按配置文件创建客户端
+func getRedisClient() redis.UniversalClient {
+	redisMu.RLock()
+	client := redisClient
+	redisMu.RUnlock()
+	if client != nil {
+		return client
+	}
+
+	redisMu.Lock()
+	defer redisMu.Unlock()
+	if redisClient == nil {
+		loadConfigLocked()
+		redisClient = NewRedisClient(rconfig)
+	}
+	return redisClient
+}
+
+// getRedisConfig 当前使用的配置及是否启用多租户，未调用 InitRedis 时读取配置文件，不创建客户端
+func getRedisConfig() (*RedisConfig, bool) {
+	redisMu.RLock()
+	if configLoaded {
+		defer redisMu.RUnlock()
+		return rconfig, useMultiTenancy
+	}
+	redisMu.RUnlock()
+
+	redisMu.Lock()
+	defer redisMu.Unlock()
+	loadConfigLocked()
+	return rconfig, useMultiTenancy
+}
+
+// loadConfigLocked 读取配置文件，调用方需持有 redisMu
+func loadConfigLocked() {
+	if configLoaded {
+		return
+	}
+	rconfig = LoadRedisConfig()
+	useMultiTenancy = config.LzqConfig.GetBool("server.UseMultiTenancy")
+	configLoaded = true
+}
+
+// RedisReady 检查Redis是否可用，用于健康检查
+func RedisReady(c context.Context) error {
+	return getRedisClient().Ping(c).Err()
+}
+
+// CloseRedis 关闭Redis客户端，之后再使用时重新按配置文件创建
+func CloseRedis() error {
+	redisMu.Lock()
+	client := redisClient
+	redisClient = nil
+	redisMu.Unlock()
+	if client == nil {
+		return nil
+	}
+	return client.Close()
+}
@@ -0,0 +1,110 @@
+package lzqpkg
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/11/12
+ * @Version 1.0.0
+ */
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// ErrCacheMiss 缓存不存在，与 Redis 连接失败等错误区分
+var ErrCacheMiss = errors.New("缓存不存在")
+
+// SGet 读取 SSet 写入的值，不存在时 found 为 false 且 err 为 nil，err 不为 nil 时为 Redis 错误或值无法反序列化
+func SGet[T any](cache Cache, key string) (value T, found bool, err error) {
+	return SGetCtx[T](ctx, cache, key)
+}
+
+// SGetCtx 同 SGet，使用传入的 context
+func SGetCtx[T any](c context.Context, cache Cache, key string) (value T, found bool, err error) {
+	str, err := cache.GetCtx(c, key)
+	return decodeJSON[T](str, err)
+}
+
+// HSGet 读取 HSSet 写入的值，返回值同 SGet
+func HSGet[T any](r *RedisHelper, key, field string) (value T, found bool, err error) {
+	return HSGetCtx[T](ctx, r, key, field)
+}
+
+// HSGetCtx 同 HSGet，使用传入的 context
+func HSGetCtx[T any](c context.Context, r *RedisHelper, key, field string) (value T, found bool, err error) {
+	hkey, err := r.buildKey(key)
+	if err != nil {
+		return value, false, err
+	}
+	str, err := getRedisClient().HGet(c, hkey, field).Result()
+	return decodeJSON[T](str, err)
+}
+
+// MSGet 批量读取 SSet 写入的值，values、found 与 keys 一一对应
+func MSGet[T any](r *RedisHelper, keys []string) (values []T, found []bool, err error) {
+	return MSGetCtx[T](ctx, r, keys)
+}
+
+// MSGetCtx 同 MSGet，使用传入的 context
+func MSGetCtx[T any](c context.Context, r *RedisHelper, keys []string) (values []T, found []bool, err error) {
+	values = make([]T, len(keys))
+	found = make([]bool, len(keys))
+	if len(keys) == 0 {
+		return values, found, nil
+	}
+	keyNs, err := r.buildKeys(keys)
+	if err != nil {
+		return values, found, err
+	}
+	result, err := r.mget(c, keyNs)
+	if err != nil {
+		return values, found, err
+	}
+	for i, v := range result {
+		str, isString := v.(string)
+		if !isString {
+			continue
+		}
+		if values[i], found[i], err = decodeJSON[T](str, nil); err != nil {
+			return values, found, err
+		}
+	}
+	return values, found, nil
+}
+
+// Deprecated: 使用 HSSetCtx
+func (r *RedisHelper) HSSet(key, field string, value interface{}, duration time.Duration) {
+	json, _ := jsoniter.MarshalToString(value)
+	r.HSet(key, field, json, duration)
+}
+
+// decodeJSON 反序列化读取到的值，err 为读取时的错误，redis.Nil 视为不存在
+func decodeJSON[T any](str string, err error) (value T, found bool, _ error) {
+	if err == redis.Nil || errors.Is(err, ErrCacheMiss) {
+		return value, false, nil
+	}
+	if err != nil {
+		return value, false, err
+	}
+	if err := jsoniter.UnmarshalFromString(str, &value); err != nil {
+		return value, false, &decodeError{err: err}
+	}
+	return value, true, nil
+}
+
+// decodeError 缓存的值无法反序列化，GetOrLoad 时重新加载覆盖
+type decodeError struct {
+	err error
+}
+
+func (e *decodeError) Error() string {
+	return "缓存的值无法反序列化：" + e.err.Error()
+}
+
+func (e *decodeError) Unwrap() error {
+	return e.err
+}
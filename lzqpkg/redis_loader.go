@@ -0,0 +1,210 @@
+package lzqpkg
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/11/5
+ * @Version 1.0.0
+ */
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 缓存击穿保护：同一进程内相同的key只有一个请求执行 loader，
+// 多个实例之间通过短时间的 Redis 锁控制，没拿到锁的请求等待其他实例写入缓存
+
+// loadLockExpiration 执行 loader 时持有的锁的过期时间，也是等待其他实例的最长时间
+const loadLockExpiration = 5 * time.Second
+
+// loadWaitInterval 等待其他实例写入缓存时的轮询间隔
+const loadWaitInterval = 50 * time.Millisecond
+
+// loadTimeout 共享加载时读写缓存、等待其他实例使用的 context 的超时时间，不受各调用方 context 的影响
+const loadTimeout = 30 * time.Second
+
+// releaseLockScript 只释放自己持有的锁
+var releaseLockScript = redis.NewScript(`if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`)
+
+type loadCall struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// loadPanicError loader panic 时其他等待的调用方收到的错误
+type loadPanicError struct {
+	value interface{}
+	stack []byte
+}
+
+func (e *loadPanicError) Error() string {
+	return fmt.Sprintf("缓存加载函数panic: %v\n%s", e.value, e.stack)
+}
+
+// loadGroup 相同key的并发调用只执行一次
+type loadGroup struct {
+	mu    sync.Mutex
+	calls map[string]*loadCall
+}
+
+var loaders = &loadGroup{calls: make(map[string]*loadCall)}
+
+// do fn 在单独的 goroutine 中执行，各调用方只等待到自己的 context 结束；
+// fn panic 时发起调用的一方（仍在等待时）重新 panic，其余调用方返回 loadPanicError
+func (g *loadGroup) do(c context.Context, key string, fn func() (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	call, isExist := g.calls[key]
+	if !isExist {
+		call = &loadCall{done: make(chan struct{})}
+		g.calls[key] = call
+		go g.run(key, call, fn)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-c.Done():
+		return nil, c.Err()
+	case <-call.done:
+	}
+	if e, isPanic := call.err.(*loadPanicError); isPanic && !isExist {
+		panic(e.value)
+	}
+	return call.value, call.err
+}
+
+func (g *loadGroup) run(key string, call *loadCall, fn func() (interface{}, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			call.value, call.err = nil, &loadPanicError{value: r, stack: debug.Stack()}
+			LogError("缓存加载函数panic", call.err)
+		}
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+	call.value, call.err = fn()
+}
+
+// GetOrLoad 读取缓存，不存在时调用 loader 并写入缓存，值使用json序列化（同 SSet）
+// ttl<=0 时使用默认过期时间，写入时过期时间加上随机值，避免大量key同时过期
+// 缓存不可用时记录日志并返回 loader 的结果，同一进程内相同的key仍只执行一次 loader
+// cache 为 RedisHelper、TwoTierCache 时多个实例之间通过 Redis 锁控制，MemoryCache 只在进程内控制
+func GetOrLoad[T any](cache Cache, key string, ttl time.Duration, loader func() (T, error)) (T, error) {
+	return GetOrLoadCtx(ctx, cache, key, ttl, loader)
+}
+
+// GetOrLoadCtx 同 GetOrLoad，context 结束时返回其错误；
+// 相同key的加载由多个调用方共享，使用单独的 context（loadTimeout），不会因为某个调用方取消而失败
+func GetOrLoadCtx[T any](c context.Context, cache Cache, key string, ttl time.Duration, loader func() (T, error)) (T, error) {
+	nKey := key
+	if scoped, isScoped := cache.(interface{ buildKey(string) (string, error) }); isScoped {
+		var err error
+		if nKey, err = scoped.buildKey(key); err != nil {
+			var zero T
+			return zero, err
+		}
+	}
+	value, found, err := SGetCtx[T](c, cache, key)
+	if found {
+		return value, nil
+	}
+	_, isDecodeErr := err.(*decodeError)
+	cacheErr := err != nil && !isDecodeErr
+	if cacheErr {
+		LogError("读取缓存失败", err)
+	}
+
+	// 同一个key可能被不同类型读取，按类型区分
+	callKey := nKey + "|" + reflect.TypeOf((*T)(nil)).Elem().String()
+	result, err := loaders.do(c, callKey, func() (interface{}, error) {
+		if cacheErr {
+			return loader()
+		}
+		loadCtx, cancel := context.WithTimeout(context.Background(), loadTimeout)
+		defer cancel()
+		switch cache.(type) {
+		case *RedisHelper, *TwoTierCache:
+			return loadWithLock(loadCtx, cache, key, nKey+":loading", ttl, loader)
+		default:
+			return loadAndSet(loadCtx, cache, key, ttl, loader)
+		}
+	})
+	// T 为接口或指针时 loader 可能返回 nil，此时 result 为 nil 的 interface{}
+	v, _ := result.(T)
+	return v, err
+}
+
+// loadWithLock 拿到锁的请求执行 loader 并写入缓存，其余请求等待
+func loadWithLock[T any](c context.Context, cache Cache, key, lockKey string, ttl time.Duration, loader func() (T, error)) (T, error) {
+	token := UuidCreate()
+	locked, err := getRedisClient().SetNX(c, lockKey, token, loadLockExpiration).Result()
+	if err != nil {
+		LogError("获取缓存加载锁失败", err)
+		return loader()
+	}
+	if !locked {
+		// 其他实例正在加载，锁释放后仍没有缓存说明加载失败，由自己加载
+		for deadline := time.Now().Add(loadLockExpiration); time.Now().Before(deadline); {
+			select {
+			case <-c.Done():
+				var zero T
+				return zero, c.Err()
+			case <-time.After(loadWaitInterval):
+			}
+			if value, found, err := SGetCtx[T](c, cache, key); found || err != nil {
+				if found {
+					return value, nil
+				}
+				break
+			}
+			if n, err := getRedisClient().Exists(c, lockKey).Result(); err != nil || n == 0 {
+				break
+			}
+		}
+		return loadAndSet(c, cache, key, ttl, loader)
+	}
+	defer func() {
+		// context 已结束时仍要释放锁，使用单独的 context
+		releaseCtx, cancel := context.WithTimeout(context.Background(), loadLockExpiration)
+		defer cancel()
+		if err := releaseLockScript.Run(releaseCtx, getRedisClient(), []string{lockKey}, token).Err(); err != nil && err != redis.Nil {
+			LogError("释放缓存加载锁失败", err)
+		}
+	}()
+	// 拿到锁之前可能已有其他实例写入
+	if value, found, _ := SGetCtx[T](c, cache, key); found {
+		return value, nil
+	}
+	return loadAndSet(c, cache, key, ttl, loader)
+}
+
+func loadAndSet[T any](c context.Context, cache Cache, key string, ttl time.Duration, loader func() (T, error)) (T, error) {
+	value, err := loader()
+	if err != nil {
+		return value, err
+	}
+	if err := cache.SSetCtx(c, key, value, jitterExpiration(ttl)); err != nil {
+		LogError("写入缓存失败", err)
+	}
+	return value, nil
+}
+
+// jitterExpiration ttl<=0 时为 GetDefaultExpiresAt，否则加上不超过 ttl/10（最多60秒）的随机值
+func jitterExpiration(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return GetDefaultExpiresAt(ttl)
+	}
+	maxSeconds := int(ttl / 10 / time.Second)
+	if maxSeconds > 60 {
+		maxSeconds = 60
+	}
+	return ttl + time.Duration(RandomNum(0, maxSeconds+1))*time.Second
+}
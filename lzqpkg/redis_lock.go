@@ -0,0 +1,261 @@
+package lzqpkg
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/12/10
+ * @Version 1.0.0
+ */
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 分布式锁：key 规则同 RedisHelper（缓存池、租户、缓存名称），实际的key为 key:lock。
+// 每次加锁生成唯一的 token，只有持有者能释放、续期；持有期间每 Expiration/3 自动续期，直到 Unlock 或续期失败；
+// 不自动续期（DisableWatchdog）时到期后自动释放。加锁时传入的 context 只控制等待加锁的时间，与持有锁的时间无关，
+// 常用的 context.WithTimeout(ctx, 2*time.Second) 超时后不会释放已获取的锁，使用完必须调用 Unlock。
+// Redlock 模式：LockOptions.RedlockClients 为多个独立的 Redis 实例，在多数实例上加锁成功才算获得锁。
+
+var (
+	// ErrLockNotAcquired 锁已被其他持有者持有
+	ErrLockNotAcquired = errors.New("未获取到锁")
+	// ErrLockNotHeld 释放时锁已过期或已被其他持有者持有
+	ErrLockNotHeld = errors.New("锁已失效")
+)
+
+// renewLockScript 只续期自己持有的锁
+var renewLockScript = redis.NewScript(`if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`)
+
+type LockOptions struct {
+	Expiration      time.Duration           //锁的过期时间，默认30s
+	RetryInterval   time.Duration           //Lock 等待时的重试间隔，默认100ms
+	DisableWatchdog bool                    //不自动续期，到期后自动释放
+	RedlockClients  []redis.UniversalClient //Redlock 模式的各实例，可用 NewRedisClient 创建，为空时使用默认客户端
+}
+
+// RedisLock 已获取的锁
+type RedisLock struct {
+	key        string
+	token      string
+	clients    []redis.UniversalClient
+	expiration time.Duration
+	stop       chan struct{}
+	stopOnce   sync.Once
+	done       chan struct{}
+	doneOnce   sync.Once
+	expiry     *time.Timer // 不自动续期时到期关闭 done
+}
+
+func (r *RedisHelper) newLock(key string, opts *LockOptions) (*RedisLock, time.Duration, error) {
+	nKey, err := r.buildKey(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	if opts == nil {
+		opts = &LockOptions{}
+	}
+	l := &RedisLock{
+		key:        nKey + ":lock",
+		token:      UuidCreate(),
+		clients:    opts.RedlockClients,
+		expiration: opts.Expiration,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	if len(l.clients) == 0 {
+		l.clients = []redis.UniversalClient{getRedisClient()}
+	}
+	if l.expiration <= 0 {
+		l.expiration = 30 * time.Second
+	}
+	retryInterval := opts.RetryInterval
+	if retryInterval <= 0 {
+		retryInterval = 100 * time.Millisecond
+	}
+	return l, retryInterval, nil
+}
+
+// TryLock 尝试加锁一次，锁已被持有时返回 ErrLockNotAcquired，context 只用于加锁的请求
+func (r *RedisHelper) TryLock(c context.Context, key string, opts *LockOptions) (*RedisLock, error) {
+	l, _, err := r.newLock(key, opts)
+	if err != nil {
+		return nil, err
+	}
+	acquired, err := l.acquire(c)
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return nil, ErrLockNotAcquired
+	}
+	l.start(opts == nil || !opts.DisableWatchdog)
+	return l, nil
+}
+
+// Lock 加锁，锁已被持有时等待，context 结束时返回 context 的错误；获取锁之后 context 结束不影响锁
+func (r *RedisHelper) Lock(c context.Context, key string, opts *LockOptions) (*RedisLock, error) {
+	l, retryInterval, err := r.newLock(key, opts)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		acquired, err := l.acquire(c)
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			l.start(opts == nil || !opts.DisableWatchdog)
+			return l, nil
+		}
+		// 错开各实例的重试时间
+		wait := retryInterval + time.Duration(RandomNum(0, int(retryInterval/time.Millisecond)/2+1))*time.Millisecond
+		select {
+		case <-c.Done():
+			return nil, c.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (l *RedisLock) quorum() int {
+	return len(l.clients)/2 + 1
+}
+
+// acquire 在各实例上加锁，未达到多数时释放已加的锁；达不到多数是因为出错时返回错误
+func (l *RedisLock) acquire(c context.Context) (bool, error) {
+	start := time.Now()
+	succeeded, failed := 0, 0
+	var lastErr error
+	for _, client := range l.clients {
+		ok, err := client.SetNX(c, l.key, l.token, l.expiration).Result()
+		if err != nil {
+			failed++
+			lastErr = err
+			continue
+		}
+		if ok {
+			succeeded++
+		}
+	}
+	// Redlock 扣除加锁耗时及各实例的时钟误差后锁仍有效
+	drift := l.expiration/100 + 2*time.Millisecond
+	if succeeded >= l.quorum() && time.Since(start)+drift < l.expiration {
+		return true, nil
+	}
+	if succeeded > 0 {
+		l.release()
+	}
+	if len(l.clients)-failed < l.quorum() {
+		return false, lastErr
+	}
+	return false, nil
+}
+
+// start 自动续期时启动 watch，否则只在到期后关闭 Done，不启动 goroutine
+func (l *RedisLock) start(watchdog bool) {
+	if watchdog {
+		go l.watch()
+		return
+	}
+	l.expiry = time.AfterFunc(l.expiration, l.finish)
+}
+
+// watch 持有期间续期，Unlock 或续期失败（锁已失效）时停止
+func (l *RedisLock) watch() {
+	ticker := time.NewTicker(l.expiration / 3)
+	defer ticker.Stop()
+	lastRenewed := time.Now()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			held, err := l.renew()
+			if err == nil && held {
+				lastRenewed = time.Now()
+				continue
+			}
+			// 出错时在锁过期前继续重试，确认锁已被他人持有或已过期时停止
+			if err == nil || time.Since(lastRenewed) >= l.expiration {
+				LogError("分布式锁续期失败，锁已失效："+l.key, err)
+				l.finish()
+				return
+			}
+		}
+	}
+}
+
+// renew 续期，多数实例续期成功时返回 true
+func (l *RedisLock) renew() (bool, error) {
+	c, cancel := context.WithTimeout(context.Background(), l.expiration/3)
+	defer cancel()
+	renewed, failed := 0, 0
+	var lastErr error
+	for _, client := range l.clients {
+		n, err := renewLockScript.Run(c, client, []string{l.key}, l.token, l.expiration.Milliseconds()).Int64()
+		if err != nil {
+			failed++
+			lastErr = err
+			continue
+		}
+		if n == 1 {
+			renewed++
+		}
+	}
+	if renewed >= l.quorum() {
+		return true, nil
+	}
+	if len(l.clients)-failed < l.quorum() {
+		return false, lastErr
+	}
+	return false, nil
+}
+
+// release 在各实例上释放自己持有的锁，返回释放成功的实例数
+func (l *RedisLock) release() (int, error) {
+	c, cancel := context.WithTimeout(context.Background(), l.expiration)
+	defer cancel()
+	released := 0
+	var lastErr error
+	for _, client := range l.clients {
+		n, err := releaseLockScript.Run(c, client, []string{l.key}, l.token).Int64()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		released += int(n)
+	}
+	return released, lastErr
+}
+
+func (l *RedisLock) finish() {
+	l.doneOnce.Do(func() { close(l.done) })
+}
+
+// Done 锁释放、续期失败（锁已失效）或不自动续期时到期后关闭，长时间执行的任务可据此停止
+func (l *RedisLock) Done() <-chan struct{} {
+	return l.done
+}
+
+// Unlock 释放锁，同加锁一样需要在多数实例上释放成功；
+// 锁已过期或已被其他持有者持有时返回 ErrLockNotHeld，达不到多数是因为出错时返回错误
+func (l *RedisLock) Unlock() error {
+	l.stopOnce.Do(func() { close(l.stop) })
+	if l.expiry != nil {
+		l.expiry.Stop()
+	}
+	defer l.finish()
+	released, err := l.release()
+	if released >= l.quorum() {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ErrLockNotHeld
+}
@@ -0,0 +1,136 @@
+package lzqpkg
+
+/**
+ * @Author  糊涂的老知青
+ * @Date    2022/12/3
+ * @Version 1.0.0
+ */
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// scanBatchSize 每次 SCAN 的 COUNT，也是 InvalidatePrefix 每批删除的数量
+const scanBatchSize = 500
+
+// escapePattern 转义 SCAN 匹配规则中的特殊字符，用于缓存池、租户等非用户传入的部分
+func escapePattern(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+	return replacer.Replace(s)
+}
+
+// scanKeys 按 match 遍历key，每批调用一次 fn，集群模式下遍历各主节点，fn 不会并发调用
+func scanKeys(c context.Context, match string, fn func(nKeys []string) error) error {
+	client := getRedisClient()
+	var mu sync.Mutex
+	scanNode := func(c context.Context, node redis.UniversalClient) error {
+		var cursor uint64
+		for {
+			nKeys, next, err := node.Scan(c, cursor, match, scanBatchSize).Result()
+			if err != nil {
+				return err
+			}
+			if len(nKeys) > 0 {
+				mu.Lock()
+				err = fn(nKeys)
+				mu.Unlock()
+				if err != nil {
+					return err
+				}
+			}
+			if next == 0 {
+				return nil
+			}
+			cursor = next
+		}
+	}
+	if cluster, isCluster := client.(*redis.ClusterClient); isCluster {
+		return cluster.ForEachMaster(c, func(c context.Context, node *redis.Client) error {
+			return scanNode(c, node)
+		})
+	}
+	return scanNode(c, client)
+}
+
+// Iterate 遍历当前缓存名称下匹配 pattern 的key（规则同 SCAN，如 user:*），fn 收到的key不含缓存池、租户、缓存名称，
+// 可直接用于 GetCtx 等方法；同一个key可能收到多次，fn 返回错误时停止遍历
+func (r *RedisHelper) Iterate(c context.Context, pattern string, fn func(key string) error) error {
+	if len(pattern) == 0 {
+		pattern = "*"
+	}
+	prefix := r.keyPrefix(r.prefixKey) + ":"
+	return scanKeys(c, escapePattern(prefix)+pattern, func(nKeys []string) error {
+		for _, nKey := range nKeys {
+			if err := fn(strings.TrimPrefix(nKey, prefix)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Scan 返回当前缓存名称下匹配 pattern 的全部key（已去重），key较多时使用 Iterate
+func (r *RedisHelper) Scan(c context.Context, pattern string) ([]string, error) {
+	keys := make([]string, 0)
+	exists := make(map[string]bool)
+	err := r.Iterate(c, pattern, func(key string) error {
+		if !exists[key] {
+			exists[key] = true
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// InvalidatePrefix 删除当前租户下缓存名称为 cacheName（包括以 cacheName: 开头的下级名称）的全部key，
+// cacheName 为完整的缓存名称，与 RedisHelper 本身的缓存名称无关，按批删除，返回删除的数量；
+// 删除后通知所有实例的 TwoTierStore 删除一级缓存中相同前缀的key
+func (r *RedisHelper) InvalidatePrefix(c context.Context, cacheName string) (int64, error) {
+	if len(cacheName) == 0 {
+		return 0, errors.New("缓存名称不能为空")
+	}
+	pool, scope, isCluster := r.keyScope(cacheName)
+	match := fmt.Sprintf("%v:*", escapePattern(pool+scope))
+	prefixes := []string{pool + scope + ":"}
+	if isCluster {
+		// 匹配 pool:{scope}:key 及 pool:{scope:下级名称}:key
+		match = fmt.Sprintf("%v[:}]*", escapePattern(pool+"{"+scope))
+		prefixes = []string{pool + "{" + scope + "}", pool + "{" + scope + ":"}
+	}
+	// 部分删除失败时已删除的key也需要通知
+	defer publishInvalidatePrefix(c, prefixes)
+
+	var deleted int64
+	client := getRedisClient()
+	err := scanKeys(c, match, func(nKeys []string) error {
+		// 集群模式下同一批key可能不在同一个slot，逐个删除，由 pipeline 合并发送
+		cmds, err := client.Pipelined(c, func(pipe redis.Pipeliner) error {
+			for _, nKey := range nKeys {
+				pipe.Del(c, nKey)
+			}
+			return nil
+		})
+		for _, cmd := range cmds {
+			deleted += cmd.(*redis.IntCmd).Val()
+		}
+		return err
+	})
+	return deleted, err
+}
+
+// publishInvalidatePrefix 通知所有实例（包括本实例）删除一级缓存中以 prefixes 开头的key
+func publishInvalidatePrefix(c context.Context, prefixes []string) {
+	_, prefixChannel := invalidateChannels()
+	for _, prefix := range prefixes {
+		if err := getRedisClient().Publish(c, prefixChannel, "|"+prefix).Err(); err != nil {
+			LogError("发送缓存失效通知失败", err)
+		}
+	}
+}